@@ -1,11 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5"
 )
 
 func (app *application) getCalendarValues(w http.ResponseWriter, r *http.Request) {
@@ -33,7 +36,7 @@ func (app *application) getCalendarValues(w http.ResponseWriter, r *http.Request
 			app.notFoundResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -68,7 +71,7 @@ func (app *application) getBookedDates(w http.ResponseWriter, r *http.Request) {
 			app.notFoundResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -135,7 +138,7 @@ func (app *application) getWorkSettings(w http.ResponseWriter, r *http.Request)
 			app.notFoundResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -155,7 +158,8 @@ func (app *application) getWorkSettings(w http.ResponseWriter, r *http.Request)
 
 type AppointmentStatusPayload struct {
 	SlotID int64  `json:"slot_id" validate:"required"`
-	Status string `json:"status" validate:"required,oneof=booked available missed completed"`
+	Status string `json:"status" validate:"required,oneof=in_progress completed missed cancelled_by_shop"`
+	Reason string `json:"reason" validate:"max=500"`
 }
 
 func (app *application) changeAppointmentStatus(w http.ResponseWriter, r *http.Request) {
@@ -171,19 +175,235 @@ func (app *application) changeAppointmentStatus(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := app.store.TimeSlots.UpdateStatus(r.Context(), payload.SlotID, payload.Status, nil, ""); err != nil {
+	worker := getUserFromContext(r)
+
+	slot, err := app.store.TimeSlots.Transition(r.Context(), store.StatusChange{
+		SlotID:   payload.SlotID,
+		To:       payload.Status,
+		ActorID:  &worker.ID,
+		WorkerID: slotWorkerFilter(worker),
+		Reason:   payload.Reason,
+	})
+	if err != nil {
 		switch err {
 		case store.Error_NotFound:
 			app.notFoundResponse(w, r, err)
 			return
+		case store.Error_InvalidTransition, store.Error_NotStarted:
+			app.conflictResponse(w, r, err)
+			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
 
+	switch payload.Status {
+	case store.StatusCancelledByShop:
+		app.notifyAppointmentChange(r.Context(), store.NotificationCancelledByShop, slot, &worker.ID, payload.Reason)
+	case store.StatusMissed:
+		app.notifyAppointmentChange(r.Context(), store.NotificationMissed, slot, &worker.ID, payload.Reason)
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, "status updated"); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
+
+type UserRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=customer worker manager owner"`
+}
+
+func (app *application) updateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload UserRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	//an owner demoting themselves could leave the shop without anyone able to manage roles
+	if owner := getUserFromContext(r); owner.ID == userID {
+		app.badRequestResponse(w, r, fmt.Errorf("you can't change your own role"))
+		return
+	}
+
+	if err := app.store.Users.UpdateRole(r.Context(), userID, payload.Role); err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, "role updated"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) unlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.Unlock(r.Context(), userID); err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, "account unlocked"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type GuestDetailsPayload struct {
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
+	Phone     string `json:"phone" validate:"required,e164"`
+	Email     string `json:"email" validate:"omitempty,email,max=255"`
+	Locale    string `json:"locale" validate:"omitempty,oneof=bs en de"`
+}
+
+type BookForCustomerPayload struct {
+	CustomerID *int64               `json:"customer_id" validate:"required_without=Guest"`
+	Guest      *GuestDetailsPayload `json:"guest" validate:"required_without=CustomerID,excluded_with=CustomerID"`
+	Service    string               `json:"service" validate:"max=100"`
+}
+
+// books a slot for an existing customer, or for a guest who gets a walk-in customer record
+func (app *application) bookForCustomer(w http.ResponseWriter, r *http.Request) {
+	slotID, err := strconv.ParseInt(chi.URLParam(r, "slotID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload BookForCustomerPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	staff := getUserFromContext(r)
+
+	var (
+		customer *store.User
+		slot     *store.BookedSlot
+	)
+	if payload.CustomerID != nil {
+		customer, err = app.store.Customers.Get(ctx, *payload.CustomerID)
+		if err != nil {
+			switch err {
+			case store.Error_NotFound:
+				app.notFoundResponse(w, r, err)
+			default:
+				app.storeErrorResponse(w, r, err)
+			}
+			return
+		}
+		slot, err = app.store.TimeSlots.BookFor(ctx, slotID, customer.ID, staff.ID, slotWorkerFilter(staff), payload.Service)
+	} else {
+		//the guest's record is created with the booking, or the one they already have with this email is used
+		slot, err = app.store.TimeSlots.BookForGuest(ctx, slotID, walkInCustomer(WalkInCustomerPayload{
+			FirstName: payload.Guest.FirstName,
+			LastName:  payload.Guest.LastName,
+			Email:     payload.Guest.Email,
+			Phone:     payload.Guest.Phone,
+			Locale:    payload.Guest.Locale,
+		}), staff.ID, slotWorkerFilter(staff), payload.Service)
+	}
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		case store.Error_DuplicateEmail:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if customer == nil {
+		if customer, err = app.store.Customers.Get(ctx, *slot.CustomerID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if recipient := recipientOf(customer); recipient.Email != "" || recipient.Phone != "" {
+		manageToken, err := app.createManageToken(ctx, slot.AppointmentID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		worker, err := app.store.Users.GetByID(ctx, slot.WorkerID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		//the slot is booked either way, a failed confirmation shouldn't make the worker book it again
+		if err := app.sendBookingConfirmation(ctx, customer, worker, slot.StartTime, app.manageURL(manageToken)); err != nil {
+			log.Printf("an error %s occured while sending the booking confirmation", err)
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, customer); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getAppointmentEvents(w http.ResponseWriter, r *http.Request) {
+	appointmentID, err := strconv.ParseInt(chi.URLParam(r, "appointmentID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	worker := getUserFromContext(r)
+
+	events, err := app.store.TimeSlots.ListEvents(r.Context(), appointmentID, slotWorkerFilter(worker))
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, events); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
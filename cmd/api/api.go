@@ -7,19 +7,27 @@ import (
 
 	"github.com/MisterDodik/Barbershop/internal/auth"
 	"github.com/MisterDodik/Barbershop/internal/mailer"
+	"github.com/MisterDodik/Barbershop/internal/notifier"
+	"github.com/MisterDodik/Barbershop/internal/oidc"
+	"github.com/MisterDodik/Barbershop/internal/passwordpolicy"
 	"github.com/MisterDodik/Barbershop/internal/ratelimiter"
 	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/MisterDodik/Barbershop/internal/webhooks"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
 type application struct {
-	config        config
-	store         store.Storage
-	authenticator auth.Authenticator
-	mailer        mailer.Client
-	rateLimiter   ratelimiter.Limiter
+	config         config
+	store          store.Storage
+	authenticator  auth.Authenticator
+	mailer         mailer.Client
+	notifier       notifier.Client
+	rateLimiter    ratelimiter.Limiter
+	oidcProviders  oidc.Registry
+	passwordPolicy *passwordpolicy.Policy
+	webhooks       *webhooks.Sender
 }
 type config struct {
 	BarbershopName     string
@@ -31,11 +39,25 @@ type config struct {
 	auth               authConfig
 	mail               mailConfig
 	rateLimiter        ratelimiter.Config
+	loginThrottle      loginThrottleConfig
+	passwordPolicy     passwordPolicyConfig
+	oidc               oidcConfig
+	cleanup            cleanupConfig
+	guestBooking       guestBookingConfig
+	sms                smsConfig
+	reminders          reminderConfig
+	webhooks           webhookConfig
 }
 type mailConfig struct {
-	mailTrap  mailTrapConfig
-	fromEmail string
-	exp       time.Duration
+	mailTrap            mailTrapConfig
+	fromEmail           string
+	fromName            string
+	replyTo             string
+	unsubscribeURL      string
+	exp                 time.Duration
+	invitationExp       time.Duration
+	resendCooldown      time.Duration //between two activation emails sent to the same account
+	workerInvitationExp time.Duration
 }
 type mailTrapConfig struct {
 	apiKey   string
@@ -45,6 +67,55 @@ type mailTrapConfig struct {
 	password string
 }
 
+type passwordPolicyConfig struct {
+	minLength            int
+	requireUpper         bool
+	requireLower         bool
+	requireDigit         bool
+	requireSymbol        bool
+	disallowPersonalInfo bool
+	breachedListPath     string
+}
+
+type cleanupConfig struct {
+	interval         time.Duration
+	unactivatedGrace time.Duration //how long after the invitation expired an unactivated user is kept
+	deletionGrace    time.Duration //how long a deletion request can still be cancelled
+}
+
+type guestBookingConfig struct {
+	holdDuration time.Duration //how long a slot is held while the guest confirms the booking
+	releaseEvery time.Duration
+	maxHolds     int //how many unconfirmed bookings an email can hold at once
+}
+
+// without a provider url texts are written to logPath, or the log when that's empty too
+type smsConfig struct {
+	providerURL  string
+	accountID    string
+	authToken    string
+	from         string
+	logPath      string
+	codeExp      time.Duration
+	codeCooldown time.Duration //between two codes sent to the same user or phone
+}
+
+type reminderConfig struct {
+	interval time.Duration
+	lead     time.Duration //how long before the appointment the reminder goes out
+}
+
+type webhookConfig struct {
+	interval  time.Duration
+	batchSize int           //deliveries sent per run
+	lease     time.Duration //how long a claimed delivery waits before another run may send it again
+}
+
+type oidcConfig struct {
+	providers []oidc.Config
+	stateExp  time.Duration
+}
+
 type authConfig struct {
 	basic basicConfig
 	token tokenConfig
@@ -79,8 +150,8 @@ func (app *application) mount() http.Handler {
 			"http://localhost:3000",                     // for local dev
 			"https://your-vercel-deployment.vercel.app", // for production
 		},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Accept-Language", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
@@ -100,28 +171,54 @@ func (app *application) mount() http.Handler {
 
 				r.Post("/cancel_appointment/{slotID}", app.cancelAppointment)
 			})
+
+			//the link from the booking email works without logging in
+			r.Get("/manage/{token}", app.getManagedBooking)
+			r.Post("/manage/{token}", app.manageBooking)
+
+			//guests book without an account, the booking only counts once the emailed link is opened
+			r.Route("/guest", func(r chi.Router) {
+				r.Post("/book/{workerID}/{slotID}", app.bookAsGuest)
+				r.Post("/confirm", app.confirmGuestBooking)
+			})
 		})
 
 		r.Route("/user", func(r chi.Router) {
 			r.Post("/request_password_reset", app.requestPasswordReset)
 			r.Post("/update_password", app.updatePassword)
+			r.Post("/confirm_email_change", app.confirmEmailChange)
 
 			r.Route("/", func(r chi.Router) {
 				r.Use(app.TokenAuthMiddleware)
 				r.Get("/user_info", app.getMyInfo)
+				r.Patch("/me", app.updateMyProfile)
+				r.Post("/change_email", app.requestEmailChange)
+				r.Post("/change_password", app.changePassword)
+				r.Get("/export", app.exportMyData)
+				r.Delete("/me", app.deleteMyAccount)
+				r.Post("/me/cancel_deletion", app.cancelMyAccountDeletion)
+				r.Post("/me/phone", app.requestPhoneVerification)
+				r.Post("/me/phone/verify", app.verifyPhone)
+				r.Delete("/me/phone", app.removePhone)
+				r.Put("/me/notification_channel", app.updateNotificationChannel)
 			})
 		})
 
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/activate/{token}", app.activateUserHandler)
+			r.Post("/resend_activation", app.resendActivationHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/accept_worker_invitation", app.acceptWorkerInvitation)
+
+			r.Get("/oidc/{provider}", app.oidcLoginHandler)
+			r.Post("/oidc/{provider}/callback", app.oidcCallbackHandler)
 		})
 
 		//authenticated endpoints
 		r.Route("/admin", func(r chi.Router) {
 			r.Use(app.TokenAuthMiddleware)
-			r.Use(app.AdminAuthMiddleware)
+			r.Use(app.RequirePermission(permAccessAdmin))
 
 			r.Post("/get_calendar", app.getCalendarValues)
 			r.Post("/get_booked_dates", app.getBookedDates)
@@ -133,10 +230,40 @@ func (app *application) mount() http.Handler {
 			r.Post("/generate_slots", app.GenerateSlots)             //samo da ako se nista ne stavi da uzme vrijednost npr 7
 
 			r.Post("/add_custom_slot", app.AddCustomSlot)
-			r.Post("/remove_slot/{slotID}", app.RemoveSlot)         //uklanja slobodni termin
-			r.Post("/bookForSomeone/{slotID}", app.bookAppointment) //mogu poslati neki payload za tog customera al aj vidjecu
+			r.Post("/remove_slot/{slotID}", app.RemoveSlot) //uklanja slobodni termin
+			r.Post("/bookForSomeone/{slotID}", app.bookForCustomer)
 
 			r.Post("/change_appointment_status", app.changeAppointmentStatus)
+			r.Get("/appointments/{appointmentID}/events", app.getAppointmentEvents)
+
+			r.Get("/customers", app.listCustomers)
+			r.Post("/customers", app.createWalkInCustomer)
+			r.Get("/customers/{customerID}", app.getCustomerHistory)
+			r.Put("/customers/{customerID}/notes", app.updateCustomerNotes)
+
+			r.With(app.RequirePermission(permManageRoles)).Post("/users/{userID}/role", app.updateUserRole)
+			r.With(app.RequirePermission(permInviteWorkers)).Post("/workers/invite", app.inviteWorker)
+			r.With(app.RequirePermission(permUnlockAccounts)).Post("/users/{userID}/unlock", app.unlockUser)
+
+			r.Route("/email_templates", func(r chi.Router) {
+				r.Use(app.RequirePermission(permManageEmails))
+
+				r.Get("/", app.listEmailTemplates)
+				r.Get("/{name}/{locale}", app.getEmailTemplate)
+				r.Put("/{name}/{locale}", app.saveEmailTemplate)
+				r.Delete("/{name}/{locale}", app.resetEmailTemplate) //vraca ugradjeni template
+				r.Post("/{name}/{locale}/preview", app.previewEmailTemplate)
+			})
+
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(app.RequirePermission(permManageWebhooks))
+
+				r.Get("/", app.listWebhooks)
+				r.Post("/", app.createWebhook)
+				r.Patch("/{webhookID}", app.updateWebhook)
+				r.Delete("/{webhookID}", app.deleteWebhook)
+				r.Get("/{webhookID}/deliveries", app.listWebhookDeliveries)
+			})
 		})
 	})
 
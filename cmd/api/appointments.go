@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,7 +12,6 @@ import (
 
 	"github.com/MisterDodik/Barbershop/internal/store"
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 )
 
 type selectedDayPayload struct {
@@ -38,7 +39,7 @@ func (app *application) getAvailableDates(w http.ResponseWriter, r *http.Request
 			app.notFoundResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -59,7 +60,7 @@ func (app *application) bookAppointment(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	user := getUserFromContext(r)
 	var workerID int64
-	if user.Role != "worker" {
+	if !store.IsStaff(user.Role) {
 		workerIDstr := chi.URLParam(r, "workerID")
 		workerID, err = strconv.ParseInt(workerIDstr, 10, 64)
 
@@ -75,54 +76,29 @@ func (app *application) bookAppointment(w http.ResponseWriter, r *http.Request)
 		app.internalServerError(w, r, err)
 		return
 	}
-	slotTime, err := app.store.TimeSlots.Book(ctx, slotID, workerID, user.ID)
+	slot, err := app.store.TimeSlots.Book(ctx, slotID, workerID, user.ID)
 	if err != nil {
 		switch err {
 		case store.Error_NotFound:
 			app.notFoundResponse(w, r, err)
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 		}
 		return
 	}
-	if slotTime == nil {
+	if slot == nil {
 		app.internalServerError(w, r, errors.New("couldn't retrive time to send a mail"))
 		return
 	}
 
-	bookedDate := slotTime.Format(time.DateOnly)
-	bookedTime := slotTime.Format(time.TimeOnly)
-
-	isProdEnv := app.config.env == "production"
-	plainToken := uuid.New()
-
-	cancelURL := fmt.Sprintf("%s/cancel?token=%s?id=%s", app.config.frontEndURL, plainToken, slotIDstr)
-	log.Print(cancelURL)
-
-	cancelWindow, err := formatDurationFromString(app.config.CancellationWindow)
+	manageToken, err := app.createManageToken(ctx, slot.AppointmentID)
 	if err != nil {
-		cancelWindow = app.config.CancellationWindow
+		app.internalServerError(w, r, err)
+		return
 	}
-	vars := struct {
-		BarbershopName  string
-		Username        string
-		AppointmentDate string
-		AppointmentTime string
-		BarberName      string
-		CancelURL       string
-		CancelWindow    string
-	}{
-		BarbershopName:  app.config.BarbershopName,
-		Username:        user.Username,
-		AppointmentDate: bookedDate,
-		AppointmentTime: bookedTime,
-		BarberName:      workerName.Username,
-		CancelURL:       cancelURL,
-		CancelWindow:    cancelWindow,
-	}
-	statusCode, err := app.mailer.Send("booked_appointment.tmpl", user.Username, user.Email, vars, isProdEnv)
-	if err != nil && statusCode != http.StatusAccepted {
-		log.Printf("an error %s occured while sending an email", err)
+
+	if err := app.sendBookingConfirmation(ctx, user, workerName, slot.StartTime, app.manageURL(manageToken)); err != nil {
+		log.Printf("an error %s occured while sending the booking confirmation", err)
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -132,6 +108,34 @@ func (app *application) bookAppointment(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// sendBookingConfirmation goes out on the customer's channel, notifier.ErrUnreachable means they left no way to reach them
+func (app *application) sendBookingConfirmation(ctx context.Context, customer, worker *store.User, slotTime time.Time, cancelURL string) error {
+	isProdEnv := app.config.env == "production"
+
+	cancelWindow, err := formatDurationFromString(app.config.CancellationWindow)
+	if err != nil {
+		cancelWindow = app.config.CancellationWindow
+	}
+
+	name := displayName(customer)
+	vars := struct {
+		BarbershopName string
+		Username       string
+		StartTime      time.Time
+		BarberName     string
+		CancelURL      string
+		CancelWindow   string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       name,
+		StartTime:      slotTime,
+		BarberName:     worker.Username,
+		CancelURL:      cancelURL,
+		CancelWindow:   cancelWindow,
+	}
+	return app.notifier.Notify(ctx, "booked_appointment.tmpl", recipientOf(customer), vars, isProdEnv)
+}
+
 func formatDurationFromString(s string) (string, error) {
 	d, err := time.ParseDuration(s)
 	if err != nil {
@@ -150,6 +154,10 @@ func formatDurationFromString(s string) (string, error) {
 	return fmt.Sprintf("%dm", minutes), nil
 }
 
+type CancelAppointmentPayload struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
 func (app *application) cancelAppointment(w http.ResponseWriter, r *http.Request) {
 	slotIDstr := chi.URLParam(r, "slotID")
 	slotID, err := strconv.ParseInt(slotIDstr, 10, 64)
@@ -159,19 +167,44 @@ func (app *application) cancelAppointment(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	//the reason is optional so an empty body is fine
+	var payload CancelAppointmentPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	user := getUserFromContext(r)
 
-	if err := app.store.TimeSlots.UpdateStatus(r.Context(), slotID, "available", &user.ID, app.config.CancellationWindow); err != nil {
+	slot, err := app.store.TimeSlots.Transition(r.Context(), store.StatusChange{
+		SlotID:             slotID,
+		To:                 store.StatusCancelledByCustomer,
+		ActorID:            &user.ID,
+		CustomerID:         &user.ID,
+		Reason:             payload.Reason,
+		CancellationWindow: app.config.CancellationWindow,
+	})
+	if err != nil {
 		switch err {
 		case store.Error_NotFound:
 			app.notFoundResponse(w, r, err)
 			return
+		case store.Error_InvalidTransition, store.Error_TooLateToChange:
+			app.conflictResponse(w, r, err)
+			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
 
+	app.notifyAppointmentChange(r.Context(), store.NotificationCancelledByCustomer, slot, &user.ID, payload.Reason)
+
 	if err := app.jsonResponse(w, http.StatusOK, "appointment canceled"); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -17,8 +17,8 @@ type UserPayload struct {
 	LastName  string `json:"last_name" validate:"required,max=100"`
 	Username  string `json:"username" validate:"required,max=100"`
 	Email     string `json:"email" validate:"required,email,max=255"`
-	Password  string `json:"password" validate:"required,min=3,max=72"`
-	Role      string `json:"role" validate:"omitempty,oneof=customer worker"`
+	Password  string `json:"password" validate:"required,max=72"`
+	Locale    string `json:"locale" validate:"omitempty,oneof=bs en de"`
 }
 
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,15 +33,21 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if err := app.passwordPolicy.Validate(payload.Password, payload.Username, payload.Email, payload.FirstName, payload.LastName); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	user := &store.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Username:  payload.Username,
 		Email:     payload.Email,
-		Role:      "customer",
+		Role:      store.RoleCustomer,
+		Locale:    payload.Locale,
 	}
-	if payload.Role == "worker" {
-		user.Role = "worker"
+	if user.Locale == "" {
+		user.Locale = requestLocale(r)
 	}
 
 	if err := user.Password.Set(payload.Password); err != nil {
@@ -49,42 +55,87 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	plainToken := uuid.New()
-	invitationExp := time.Hour * 24
 
-	err := app.store.Users.CreateAndInvite(r.Context(), user, plainToken.String(), invitationExp)
+	claimedWalkIn, err := app.store.Users.CreateAndInvite(r.Context(), user, plainToken.String(), app.config.mail.invitationExp)
 	if err != nil {
-		switch err {
-		case store.Error_DuplicateEmail:
-			app.badRequestResponse(w, r, err)
-		case store.Error_DuplicateUsername:
-			app.badRequestResponse(w, r, err)
-		default:
-			app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	statusCode, err := app.sendActivationEmail(user, plainToken.String())
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured. Deleting user invitations from the database", err)
+		var undoErr error
+		if claimedWalkIn {
+			//the walk-in record keeps the customer's appointments and notes
+			undoErr = app.store.Users.ReleaseWalkIn(r.Context(), user.ID, plainToken.String())
+		} else {
+			undoErr = app.store.Users.DeleteUserWithInvitation(r.Context(), user.ID, plainToken.String())
+		}
+		if undoErr != nil {
+			log.Printf("could not undo the registration of user %d: %s", user.ID, undoErr)
 		}
+		app.internalServerError(w, r, err)
 		return
 	}
+	if err := app.jsonResponse(w, http.StatusCreated, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) sendActivationEmail(user *store.User, plainToken string) (int, error) {
 	isProdEnv := app.config.env == "production"
 
 	activationUrl := fmt.Sprintf("%s/activate?token=%s", app.config.frontEndURL, plainToken)
-	log.Printf("Activation token: %s", plainToken.String())
 	vars := struct {
 		BarbershopName string
 		Username       string
 		ActivationURL  string
 	}{
 		BarbershopName: app.config.BarbershopName,
-		Username:       payload.Username,
+		Username:       user.Username,
 		ActivationURL:  activationUrl,
 	}
 
-	statusCode, err := app.mailer.Send("user_invitation.tmpl", payload.Username, payload.Email, vars, isProdEnv)
-	if err != nil && statusCode != http.StatusAccepted {
-		log.Printf("an error %s occured. Deleting user invitations from the database", err)
-		err = app.store.Users.DeleteUserWithInvitation(r.Context(), user.ID, plainToken.String())
-		app.internalServerError(w, r, err)
+	return app.mailer.Send("user_invitation.tmpl", user.Locale, user.Username, user.Email, vars, isProdEnv)
+}
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// responds the same way whether or not a pending account exists so it can't be used to probe emails,
+// an account is sent at most one email per resend cooldown
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
-	if err := app.jsonResponse(w, http.StatusCreated, nil); err != nil {
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	user, err := app.store.Users.ReissueInvitation(r.Context(), payload.Email, plainToken, app.config.mail.invitationExp, app.config.mail.resendCooldown)
+	switch err {
+	case nil:
+		//a failed email is only logged, an error would tell that the account exists
+		statusCode, err := app.sendActivationEmail(user, plainToken)
+		if err != nil && statusCode != http.StatusAccepted {
+			log.Printf("could not resend the activation email of user %d: %s", user.ID, err)
+		}
+	case store.Error_NotFound, store.Error_InvitationRecent:
+	default:
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, "if the account is waiting for activation, a new email has been sent"); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -94,7 +145,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	token := chi.URLParam(r, "token")
 
 	if err := app.store.Users.Activate(r.Context(), token); err != nil {
-		app.internalServerError(w, r, err)
+		app.storeErrorResponse(w, r, err)
 		return
 	}
 
@@ -122,33 +173,45 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
+	ip := clientIP(r)
+
+	retryAfter, err := app.loginRetryAfter(ctx, payload.Email, ip)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if retryAfter > 0 {
+		app.rateLimitExceededResponse(w, r, retryAfter.String())
+		return
+	}
+
 	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
 		switch err {
 		case store.Error_NotFound:
+			app.recordFailedLogin(ctx, nil, payload.Email, ip)
 			app.unauthorizedErrorResponse(w, r, err)
 		case store.Error_UserNotVerified:
 			app.unauthorizedErrorResponse(w, r, err)
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 		}
 		return
 	}
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		app.accountLockedResponse(w, r, time.Until(*user.LockedUntil).Round(time.Second).String())
+		return
+	}
 	if !user.Password.ComparePasswords(payload.Password) {
+		app.recordFailedLogin(ctx, user, payload.Email, ip)
 		app.unauthorizedErrorResponse(w, r, fmt.Errorf("incorrect password"))
 		return
 	}
-
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(app.config.auth.token.expDate).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": app.config.auth.token.iss,
-		"aud": app.config.auth.token.iss,
+	if err := app.store.FailedLogins.Clear(ctx, payload.Email); err != nil {
+		log.Printf("error clearing failed logins: %s", err)
 	}
 
-	token, err := app.authenticator.GenerateToken(claims)
+	token, err := app.generateUserToken(user)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -158,3 +221,16 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+func (app *application) generateUserToken(user *store.User) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"exp": time.Now().Add(app.config.auth.token.expDate).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.iss,
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/notifier"
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type CustomerQueryParams struct {
+	Search string `validate:"max=100"`
+	Sort   string `validate:"omitempty,oneof=name email created_at"`
+	Order  string `validate:"omitempty,oneof=asc desc"`
+	Limit  int    `validate:"min=1,max=100"`
+	Offset int    `validate:"min=0"`
+}
+
+// ?search=&sort=name|email|created_at&order=asc|desc&limit=&offset=
+func (app *application) listCustomers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := CustomerQueryParams{
+		Search: query.Get("search"),
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+		Limit:  20,
+	}
+
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid limit"))
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if params.Offset, err = strconv.Atoi(offset); err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid offset"))
+			return
+		}
+	}
+
+	if err := Validate.Struct(params); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	customers, err := app.store.Customers.Search(r.Context(), store.CustomerQuery{
+		Search: params.Search,
+		Sort:   params.Sort,
+		Order:  params.Order,
+		Limit:  params.Limit,
+		Offset: params.Offset,
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, customers); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type WalkInCustomerPayload struct {
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required_without=Phone,omitempty,email,max=255"`
+	Phone     string `json:"phone" validate:"required_without=Email,omitempty,e164"`
+	Locale    string `json:"locale" validate:"omitempty,oneof=bs en de"`
+}
+
+// creates a customer record for someone who walked in or called, without an account or email verification
+func (app *application) createWalkInCustomer(w http.ResponseWriter, r *http.Request) {
+	var payload WalkInCustomerPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	customer := walkInCustomer(payload)
+	if err := app.store.Customers.CreateWalkIn(r.Context(), customer); err != nil {
+		switch err {
+		case store.Error_DuplicateEmail:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, customer); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// walkInCustomer builds the record of a customer the staff took the details of
+func walkInCustomer(payload WalkInCustomerPayload) *store.User {
+	customer := &store.User{
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Email:     payload.Email,
+		Locale:    payload.Locale,
+	}
+	//the staff took the number down in person, a customer without an email can only be texted
+	if payload.Phone != "" {
+		now := time.Now()
+		customer.Phone = &payload.Phone
+		customer.PhoneVerifiedAt = &now
+		if payload.Email == "" {
+			customer.NotificationChannel = notifier.ChannelSMS
+		}
+	}
+	return customer
+}
+
+func (app *application) getCustomerHistory(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "customerID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	history, err := app.store.Customers.GetHistory(r.Context(), customerID)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, history); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type CustomerNotesPayload struct {
+	Notes          string `json:"notes" validate:"max=5000"`
+	Allergies      string `json:"allergies" validate:"max=1000"`
+	PreferredStyle string `json:"preferred_style" validate:"max=1000"`
+}
+
+func (app *application) updateCustomerNotes(w http.ResponseWriter, r *http.Request) {
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "customerID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload CustomerNotesPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	worker := getUserFromContext(r)
+
+	notes := &store.CustomerNotes{
+		CustomerID:     customerID,
+		Notes:          payload.Notes,
+		Allergies:      payload.Allergies,
+		PreferredStyle: payload.PreferredStyle,
+		UpdatedBy:      &worker.ID,
+	}
+	if err := app.store.Customers.UpsertNotes(r.Context(), notes); err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, notes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
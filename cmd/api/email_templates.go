@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/locale"
+	"github.com/MisterDodik/Barbershop/internal/mailer"
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// templateOverrides lets the mailer send the templates saved in the admin
+type templateOverrides struct {
+	store store.Storage
+}
+
+func (o templateOverrides) Find(templateFile, lang string) (*mailer.Override, error) {
+	emailTemplate, err := o.store.EmailTemplates.Get(context.Background(), templateFile, lang)
+	switch err {
+	case nil:
+		return &mailer.Override{Subject: emailTemplate.Subject, Body: emailTemplate.Body}, nil
+	case store.Error_NotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+type EmailTemplateSummary struct {
+	Name       string   `json:"name"`
+	Variables  []string `json:"variables"`
+	Overridden []string `json:"overridden_locales"`
+}
+
+type EmailTemplateResponse struct {
+	Name       string     `json:"name"`
+	Locale     string     `json:"locale"`
+	Subject    string     `json:"subject"`
+	Body       string     `json:"body"`
+	Variables  []string   `json:"variables"`
+	Overridden bool       `json:"overridden"`
+	UpdatedBy  *int64     `json:"updated_by,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+type EmailTemplatePayload struct {
+	Subject string `json:"subject" validate:"required,max=255"`
+	Body    string `json:"body" validate:"required,max=100000"`
+}
+
+func templateVariables(templateFile string) ([]string, error) {
+	fields, _, err := mailer.Variables(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	variables := make([]string, 0, len(fields))
+	for field := range fields {
+		variables = append(variables, field)
+	}
+	sort.Strings(variables)
+	return variables, nil
+}
+
+// emailTemplateParams reads the template file and locale from the path, ok is false when the response was already written
+func (app *application) emailTemplateParams(w http.ResponseWriter, r *http.Request) (templateFile, lang string, ok bool) {
+	templateFile = chi.URLParam(r, "name")
+	lang = chi.URLParam(r, "locale")
+	if !mailer.IsTemplate(templateFile) {
+		app.notFoundResponse(w, r, errors.New("there is no template named "+templateFile))
+		return "", "", false
+	}
+	if !locale.IsSupported(lang) {
+		app.notFoundResponse(w, r, errors.New("unsupported locale "+lang))
+		return "", "", false
+	}
+	return templateFile, lang, true
+}
+
+func (app *application) listEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	overrides, err := app.store.EmailTemplates.List(r.Context())
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	overridden := map[string][]string{}
+	for _, override := range overrides {
+		overridden[override.Name] = append(overridden[override.Name], override.Locale)
+	}
+
+	summaries := make([]EmailTemplateSummary, 0, len(templates))
+	for _, templateFile := range templates {
+		variables, err := templateVariables(templateFile)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		locales := overridden[templateFile]
+		if locales == nil {
+			locales = []string{}
+		}
+		summaries = append(summaries, EmailTemplateSummary{
+			Name:       templateFile,
+			Variables:  variables,
+			Overridden: locales,
+		})
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, summaries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getEmailTemplate returns the saved override or, when there is none, the embedded template to start editing from
+func (app *application) getEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	templateFile, lang, ok := app.emailTemplateParams(w, r)
+	if !ok {
+		return
+	}
+
+	variables, err := templateVariables(templateFile)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	response := EmailTemplateResponse{
+		Name:      templateFile,
+		Locale:    lang,
+		Variables: variables,
+	}
+
+	emailTemplate, err := app.store.EmailTemplates.Get(r.Context(), templateFile, lang)
+	switch err {
+	case nil:
+		response.Subject = emailTemplate.Subject
+		response.Body = emailTemplate.Body
+		response.Overridden = true
+		response.UpdatedBy = emailTemplate.UpdatedBy
+		response.UpdatedAt = &emailTemplate.UpdatedAt
+	case store.Error_NotFound:
+		source, err := mailer.Source(templateFile, lang)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		response.Subject = source.Subject
+		response.Body = source.Body
+	default:
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// previewEmailTemplate renders the posted subject and body with sample data without saving them,
+// along with the plain text part derived from the body
+func (app *application) previewEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	templateFile, lang, ok := app.emailTemplateParams(w, r)
+	if !ok {
+		return
+	}
+
+	override, ok := app.readEmailTemplatePayload(w, r, templateFile)
+	if !ok {
+		return
+	}
+
+	data, err := mailer.SampleData(templateFile)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if _, found := data["BarbershopName"]; found {
+		data["BarbershopName"] = app.config.BarbershopName
+	}
+
+	email, err := mailer.Render(templateFile, lang, override, data)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) saveEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	templateFile, lang, ok := app.emailTemplateParams(w, r)
+	if !ok {
+		return
+	}
+
+	override, ok := app.readEmailTemplatePayload(w, r, templateFile)
+	if !ok {
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	emailTemplate := &store.EmailTemplate{
+		Name:      templateFile,
+		Locale:    lang,
+		Subject:   override.Subject,
+		Body:      override.Body,
+		UpdatedBy: &user.ID,
+	}
+	if err := app.store.EmailTemplates.Upsert(r.Context(), emailTemplate); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, emailTemplate); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// resetEmailTemplate deletes the override, the embedded template is sent from then on
+func (app *application) resetEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	templateFile, lang, ok := app.emailTemplateParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.store.EmailTemplates.Delete(r.Context(), templateFile, lang); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// readEmailTemplatePayload decodes the subject and body and checks they are a template the mailer can send
+func (app *application) readEmailTemplatePayload(w http.ResponseWriter, r *http.Request, templateFile string) (*mailer.Override, bool) {
+	var payload EmailTemplatePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	override := &mailer.Override{Subject: payload.Subject, Body: payload.Body}
+	if err := mailer.ValidateOverride(templateFile, override); err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	return override, true
+}
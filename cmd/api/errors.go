@@ -3,33 +3,41 @@ package main
 import (
 	"log"
 	"net/http"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("internal server error, method %s, path %s, error %s", r.Method, r.URL.Path, err.Error())
-	writeJSONError(w, http.StatusInternalServerError, "the server encountered a problem")
+	writeProblem(w, r, http.StatusInternalServerError, codeInternalError, localizedMessage(r, codeInternalError, "the server encountered a problem"), nil)
 }
 func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request) {
 	log.Printf("forbidden, method %s, path %s, error ", r.Method, r.URL.Path)
-	writeJSONError(w, http.StatusForbidden, "forbidden")
+	writeProblem(w, r, http.StatusForbidden, codeForbidden, localizedMessage(r, codeForbidden, ""), nil)
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("bad request error, method %s, path %s, error %s", r.Method, r.URL.Path, err.Error())
-	writeJSONError(w, http.StatusBadRequest, err.Error())
+	code, detail, fieldErrors := describeBadRequest(err)
+	//a plain bad request carries our own explanation, the other codes have a translated one
+	if code != codeBadRequest {
+		detail = localizedMessage(r, code, detail)
+	}
+	writeProblem(w, r, http.StatusBadRequest, code, detail, fieldErrors)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("not found error, method %s, path %s, error %s", r.Method, r.URL.Path, err.Error())
-	writeJSONError(w, http.StatusNotFound, "not found")
+	writeProblem(w, r, http.StatusNotFound, codeNotFound, localizedMessage(r, codeNotFound, ""), nil)
 }
 func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("conflict error, method %s, path %s, error %s", r.Method, r.URL.Path, err.Error())
-	writeJSONError(w, http.StatusConflict, err.Error())
+	code, detail := describeError(r, err, codeConflict)
+	writeProblem(w, r, http.StatusConflict, code, detail, nil)
 }
 func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	log.Printf("unauthorized error, method %s, path %s, error %s", r.Method, r.URL.Path, err.Error())
-	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+	writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, localizedMessage(r, codeUnauthorized, ""), nil)
 }
 
 func (app *application) unauthorizedBasicErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
@@ -37,7 +45,7 @@ func (app *application) unauthorizedBasicErrorResponse(w http.ResponseWriter, r
 
 	w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
 
-	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+	writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, localizedMessage(r, codeUnauthorized, ""), nil)
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
@@ -45,5 +53,39 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 
 	w.Header().Set("Retry-After", retryAfter)
 
-	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
+	writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited, localizedMessage(r, codeRateLimited, "rate limit exceeded, retry after: "+retryAfter, retryAfter), nil)
+}
+
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
+	log.Printf("account locked, method %s, path %s", r.Method, r.URL.Path)
+
+	w.Header().Set("Retry-After", retryAfter)
+
+	writeProblem(w, r, http.StatusLocked, codeAccountLocked, localizedMessage(r, codeAccountLocked, "account temporarily locked, retry after: "+retryAfter, retryAfter), nil)
+}
+
+func (app *application) retryResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("retry error, method %s, path %s, error %s", r.Method, r.URL.Path, err.Error())
+
+	w.Header().Set("Retry-After", "1")
+
+	code, detail := describeError(r, err, codeRetry)
+	writeProblem(w, r, http.StatusServiceUnavailable, code, detail, nil)
+}
+
+// storeErrorResponse answers with the status a typed store error stands for,
+// any other error is an internal server error
+func (app *application) storeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case store.Error_NotFound:
+		app.notFoundResponse(w, r, err)
+	case store.Error_Conflict, store.Error_DuplicateEmail, store.Error_DuplicateUsername, store.Error_SlotOverlap, store.Error_PhoneNotVerified:
+		app.conflictResponse(w, r, err)
+	case store.Error_InvalidReference, store.Error_InvalidValue, store.Error_InvalidCode:
+		app.badRequestResponse(w, r, err)
+	case store.Error_Retry:
+		app.retryResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type GuestBookingPayload struct {
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
+	Email     string `json:"email" validate:"required,email,max=255"`
+	Phone     string `json:"phone" validate:"required,e164"`
+}
+
+// holds the slot and emails the guest a link that confirms the booking
+func (app *application) bookAsGuest(w http.ResponseWriter, r *http.Request) {
+	workerID, err := strconv.ParseInt(chi.URLParam(r, "workerID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	slotID, err := strconv.ParseInt(chi.URLParam(r, "slotID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload GuestBookingPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	worker, err := app.store.Users.GetByID(ctx, workerID)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	request := &store.GuestBookingRequest{
+		SlotID:    slotID,
+		WorkerID:  worker.ID,
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Email:     payload.Email,
+		Phone:     payload.Phone,
+		Locale:    requestLocale(r),
+		ExpiresAt: time.Now().Add(app.config.guestBooking.holdDuration),
+	}
+	plainToken := uuid.New().String()
+
+	slotTime, err := app.store.GuestBookings.Hold(ctx, request, plainToken, app.config.guestBooking.maxHolds)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		case store.Error_TooManyHolds:
+			//one of the holds runs out within the hold duration at the latest
+			app.rateLimitExceededResponse(w, r, app.config.guestBooking.holdDuration.String())
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	holdMinutes, err := formatDurationFromString(app.config.guestBooking.holdDuration.String())
+	if err != nil {
+		holdMinutes = app.config.guestBooking.holdDuration.String()
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		BarbershopName string
+		Username       string
+		StartTime      time.Time
+		BarberName     string
+		ConfirmURL     string
+		HoldDuration   string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       payload.FirstName,
+		StartTime:      *slotTime,
+		BarberName:     worker.Username,
+		ConfirmURL:     fmt.Sprintf("%s/confirm-booking?token=%s", app.config.frontEndURL, plainToken),
+		HoldDuration:   holdMinutes,
+	}
+	statusCode, err := app.mailer.Send("guest_booking_confirm.tmpl", request.Locale, payload.FirstName, payload.Email, vars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured. Releasing the held slot", err)
+		if err := app.store.GuestBookings.Delete(ctx, plainToken); err != nil {
+			log.Printf("error releasing the held slot: %s", err)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, "confirmation email sent"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ConfirmGuestBookingPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type GuestBookingResponse struct {
+	AppointmentID int64     `json:"appointment_id"`
+	SlotID        int64     `json:"slot_id"`
+	StartTime     time.Time `json:"start_time"`
+	ManageToken   string    `json:"manage_token"`
+}
+
+func (app *application) confirmGuestBooking(w http.ResponseWriter, r *http.Request) {
+	var payload ConfirmGuestBookingPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	booking, err := app.store.GuestBookings.Confirm(ctx, payload.Token)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.badRequestResponse(w, r, err)
+		case store.Error_Expired:
+			app.badRequestResponse(w, r, err)
+		case store.Error_DuplicateEmail:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	manageToken, err := app.createManageToken(ctx, booking.Slot.AppointmentID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	worker, err := app.store.Users.GetByID(ctx, booking.Slot.WorkerID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.sendBookingConfirmation(ctx, booking.Customer, worker, booking.Slot.StartTime, app.manageURL(manageToken)); err != nil {
+		log.Printf("an error %s occured while sending the booking confirmation", err)
+	}
+
+	response := GuestBookingResponse{
+		AppointmentID: booking.Slot.AppointmentID,
+		SlotID:        booking.Slot.ID,
+		StartTime:     booking.Slot.StartTime,
+		ManageToken:   manageToken,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -9,6 +9,6 @@ func (app *application) getHealthHandler(w http.ResponseWriter, r *http.Request)
 		"version": version,
 	}
 	if err := app.jsonResponse(w, http.StatusOK, data); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "something went wrong")
+		app.internalServerError(w, r, err)
 	}
 }
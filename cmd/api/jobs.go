@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+)
+
+// scheduleJob runs fn every interval in the background for the lifetime of the process
+func (app *application) scheduleJob(name string, interval time.Duration, fn func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := fn(ctx); err != nil {
+				log.Printf("job %q failed: %s", name, err)
+			}
+			cancel()
+		}
+	}()
+}
+
+func (app *application) purgeUnactivatedUsers(ctx context.Context) error {
+	cutoff := time.Now().Add(-app.config.cleanup.unactivatedGrace)
+
+	deleted, err := app.store.Users.DeleteUnactivated(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("purged %d unactivated users", deleted)
+	}
+	return nil
+}
+
+func (app *application) anonymiseDeletedUsers(ctx context.Context) error {
+	cutoff := time.Now().Add(-app.config.cleanup.deletionGrace)
+
+	anonymised, err := app.store.UserData.AnonymiseDue(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if anonymised > 0 {
+		log.Printf("anonymised %d deleted users", anonymised)
+	}
+	return nil
+}
+
+func (app *application) purgeFailedLogins(ctx context.Context) error {
+	cutoff := time.Now().Add(-app.config.loginThrottle.window)
+
+	deleted, err := app.store.FailedLogins.DeleteBefore(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("purged %d failed logins", deleted)
+	}
+	return nil
+}
+
+func (app *application) releaseGuestBookingHolds(ctx context.Context) error {
+	released, err := app.store.GuestBookings.ReleaseExpiredHolds(ctx)
+	if err != nil {
+		return err
+	}
+	if released > 0 {
+		log.Printf("released %d unconfirmed guest bookings", released)
+	}
+	return nil
+}
+
+// sendAppointmentReminders reminds customers of the appointments starting within the lead time,
+// each appointment once
+func (app *application) sendAppointmentReminders(ctx context.Context) error {
+	due, err := app.store.Notifications.ClaimDueReminders(ctx, time.Now().Add(app.config.reminders.lead))
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		app.notifyAppointmentChange(ctx, store.NotificationReminder, &due[i], nil, "")
+	}
+	if len(due) > 0 {
+		log.Printf("sent %d appointment reminders", len(due))
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+	Validate.RegisterTagNameFunc(jsonFieldName)
 	Validate.RegisterValidation("validduration", func(fl validator.FieldLevel) bool {
 		durationStr := fl.Field().String()
 		_, err := time.ParseDuration(durationStr)
@@ -36,13 +37,6 @@ func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
 	return decoder.Decode(data)
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) error {
-
-	type JSONError struct {
-		Error string `json:"error"`
-	}
-	return writeJSON(w, status, &JSONError{Error: message})
-}
 func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
 	type envelope struct {
 		Data any `json:"data"`
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/MisterDodik/Barbershop/internal/locale"
+)
+
+// requestLocale is the language the response is written in. The preference stored for the logged in
+// user wins, Accept-Language is only negotiated for anonymous requests or users without a stored one
+func requestLocale(r *http.Request) string {
+	if user := getUserFromContext(r); user != nil && locale.IsSupported(user.Locale) {
+		return user.Locale
+	}
+	if acceptLanguage := r.Header.Get("Accept-Language"); acceptLanguage != "" {
+		return locale.Negotiate(acceptLanguage)
+	}
+	return locale.Default
+}
+
+// localizedMessage returns the message for the code in the request's language, or the fallback
+// when the code has no message of its own
+func localizedMessage(r *http.Request, code, fallback string, args ...any) string {
+	message, ok := locale.Message(requestLocale(r), code)
+	if !ok {
+		return fallback
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
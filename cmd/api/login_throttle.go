@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+)
+
+type loginThrottleConfig struct {
+	window           time.Duration //failures older than this are forgotten
+	freeAttempts     int           //failures allowed before the delays start
+	baseDelay        time.Duration
+	maxDelay         time.Duration
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+	maxFailuresPerIP int
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginRetryAfter returns how long the client has to wait before it can try to log in again,
+// the delay doubles with every failure for the account after the free attempts
+func (app *application) loginRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	cfg := app.config.loginThrottle
+
+	stats, err := app.store.FailedLogins.Stats(ctx, email, ip, time.Now().Add(-cfg.window))
+	if err != nil {
+		return 0, err
+	}
+
+	if stats.ByIP >= cfg.maxFailuresPerIP {
+		return cfg.window, nil
+	}
+
+	if stats.ByEmail < cfg.freeAttempts || stats.LastByEmail == nil {
+		return 0, nil
+	}
+
+	delay := cfg.baseDelay << (stats.ByEmail - cfg.freeAttempts)
+	if delay > cfg.maxDelay || delay <= 0 {
+		delay = cfg.maxDelay
+	}
+
+	retryAfter := time.Until(stats.LastByEmail.Add(delay))
+	if retryAfter < 0 {
+		return 0, nil
+	}
+	return retryAfter.Round(time.Second), nil
+}
+
+// recordFailedLogin stores the failure and locks the account once it crosses the threshold,
+// user is nil when nobody is registered with the email
+func (app *application) recordFailedLogin(ctx context.Context, user *store.User, email, ip string) {
+	cfg := app.config.loginThrottle
+
+	if err := app.store.FailedLogins.Record(ctx, email, ip); err != nil {
+		log.Printf("error recording failed login: %s", err)
+		return
+	}
+	if user == nil {
+		return
+	}
+
+	stats, err := app.store.FailedLogins.Stats(ctx, email, ip, time.Now().Add(-cfg.window))
+	if err != nil {
+		log.Printf("error reading failed logins: %s", err)
+		return
+	}
+	if stats.ByEmail < cfg.lockoutThreshold {
+		return
+	}
+
+	lockedUntil := time.Now().Add(cfg.lockoutDuration)
+	locked, err := app.store.Users.Lock(ctx, user.ID, lockedUntil)
+	if err != nil {
+		log.Printf("error locking user %d: %s", user.ID, err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	lockedFor, err := formatDurationFromString(cfg.lockoutDuration.String())
+	if err != nil {
+		lockedFor = cfg.lockoutDuration.String()
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		BarbershopName string
+		Username       string
+		LockedFor      string
+		ResetURL       string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       user.Username,
+		LockedFor:      lockedFor,
+		ResetURL:       fmt.Sprintf("%s/forgot-password", app.config.frontEndURL),
+	}
+	statusCode, err := app.mailer.Send("account_locked.tmpl", user.Locale, user.Username, user.Email, vars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured while sending an email", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// createManageToken gives the appointment a fresh manage link token, only its hash is stored
+func (app *application) createManageToken(ctx context.Context, appointmentID int64) (string, error) {
+	plainToken := uuid.New().String()
+	if err := app.store.TimeSlots.SetManageToken(ctx, appointmentID, plainToken); err != nil {
+		return "", err
+	}
+	return plainToken, nil
+}
+
+func (app *application) manageURL(plainToken string) string {
+	return fmt.Sprintf("%s/booking?token=%s", app.config.frontEndURL, plainToken)
+}
+
+func (app *application) getManagedBooking(w http.ResponseWriter, r *http.Request) {
+	booking, err := app.store.TimeSlots.GetByManageToken(r.Context(), chi.URLParam(r, "token"), app.config.CancellationWindow)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, booking); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ManageBookingPayload struct {
+	Action    string `json:"action" validate:"required,oneof=cancel reschedule"`
+	NewSlotID int64  `json:"new_slot_id" validate:"required_if=Action reschedule"`
+	Reason    string `json:"reason" validate:"max=500"`
+}
+
+// cancels or moves the booking behind the link, both only outside the cancellation window
+func (app *application) manageBooking(w http.ResponseWriter, r *http.Request) {
+	var payload ManageBookingPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	token := chi.URLParam(r, "token")
+
+	var (
+		booking *store.ManagedBooking
+		err     error
+	)
+	switch payload.Action {
+	case "cancel":
+		booking, err = app.store.TimeSlots.CancelByManageToken(ctx, token, payload.Reason, app.config.CancellationWindow)
+	case "reschedule":
+		booking, err = app.store.TimeSlots.RescheduleByManageToken(ctx, token, payload.NewSlotID, app.config.CancellationWindow)
+	}
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		case store.Error_TooLateToChange:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if payload.Action == "cancel" {
+		slot := &store.BookedSlot{
+			AppointmentID: booking.AppointmentID,
+			StartTime:     booking.StartTime,
+			WorkerID:      booking.WorkerID,
+			CustomerID:    &booking.CustomerID,
+		}
+		if booking.SlotID != nil {
+			slot.ID = *booking.SlotID
+		}
+		app.notifyAppointmentChange(ctx, store.NotificationCancelledByCustomer, slot, &booking.CustomerID, payload.Reason)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, booking); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
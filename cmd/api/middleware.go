@@ -49,20 +49,17 @@ func (app *application) TokenAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		ctx = context.WithValue(ctx, userCtx, user)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
-}
-
-func (app *application) AdminAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		worker := getUserFromContext(r)
-		if worker == nil || worker.Role != "worker" {
-			app.unauthorizedErrorResponse(w, r, fmt.Errorf("you dont have permissions to access this"))
-			return
+		//tokens issued before a password change belong to sessions that were logged out
+		if user.TokensValidAfter != nil {
+			issuedAt, _ := claims["iat"].(float64)
+			if int64(issuedAt) < user.TokensValidAfter.Unix() {
+				app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has been revoked"))
+				return
+			}
 		}
 
-		next.ServeHTTP(w, r)
+		ctx = context.WithValue(ctx, userCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
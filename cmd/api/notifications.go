@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/notifier"
+	"github.com/MisterDodik/Barbershop/internal/store"
+)
+
+// template sent for each appointment event
+var notificationTemplates = map[string]string{
+	store.NotificationCancelledByCustomer: "appointment_cancelled_by_customer.tmpl",
+	store.NotificationCancelledByShop:     "appointment_cancelled_by_shop.tmpl",
+	store.NotificationMissed:              "appointment_missed.tmpl",
+	store.NotificationReminder:            "appointment_reminder.tmpl",
+}
+
+// recipientOf addresses the user on their picked channel, the phone only counts once it's verified
+func recipientOf(user *store.User) notifier.Recipient {
+	recipient := notifier.Recipient{
+		Name:    displayName(user),
+		Email:   user.Email,
+		Locale:  user.Locale,
+		Channel: user.NotificationChannel,
+	}
+	if user.Phone != nil && user.PhoneVerifiedAt != nil {
+		recipient.Phone = *user.Phone
+	}
+	return recipient
+}
+
+// displayName is what emails call a user, walk-in customers only have a generated username
+func displayName(user *store.User) string {
+	if user.IsWalkIn {
+		return user.FirstName
+	}
+	return user.Username
+}
+
+// notifyAppointmentChange tells the other party about a change to the slot, or reminds the customer of it,
+// on their channel and records it. Customer cancellations go to the worker, everything else to the customer.
+// The change already happened so failures are only logged.
+func (app *application) notifyAppointmentChange(ctx context.Context, event string, slot *store.BookedSlot, actorID *int64, reason string) {
+	if slot.CustomerID == nil {
+		return
+	}
+
+	worker, err := app.store.Users.GetByID(ctx, slot.WorkerID)
+	if err != nil {
+		log.Printf("error loading worker %d for the %s notification: %s", slot.WorkerID, event, err)
+		return
+	}
+	customer, err := app.store.Customers.Get(ctx, *slot.CustomerID)
+	if err != nil {
+		log.Printf("error loading customer %d for the %s notification: %s", *slot.CustomerID, event, err)
+		return
+	}
+
+	recipient := customer
+	if event == store.NotificationCancelledByCustomer {
+		recipient = worker
+	}
+
+	notification := &store.AppointmentNotification{
+		AppointmentID: slot.AppointmentID,
+		Event:         event,
+		ActorID:       actorID,
+		RecipientID:   recipient.ID,
+		Reason:        reason,
+		Delivery:      store.DeliverySent,
+	}
+	if slot.ID != 0 {
+		notification.SlotID = &slot.ID
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		BarbershopName string
+		Username       string
+		CustomerName   string
+		BarberName     string
+		StartTime      time.Time
+		Reason         string
+		BookingURL     string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       displayName(recipient),
+		CustomerName:   customer.FirstName + " " + customer.LastName,
+		BarberName:     worker.Username,
+		StartTime:      slot.StartTime,
+		Reason:         reason,
+		BookingURL:     app.config.frontEndURL,
+	}
+	err = app.notifier.Notify(ctx, notificationTemplates[event], recipientOf(recipient), vars, isProdEnv)
+	switch {
+	case errors.Is(err, notifier.ErrUnreachable):
+		notification.Delivery = store.DeliverySkipped
+	case err != nil:
+		log.Printf("an error %s occured while sending the %s notification", err, event)
+		notification.Delivery = store.DeliveryFailed
+	}
+
+	if err := app.store.Notifications.Record(ctx, notification); err != nil {
+		log.Printf("error recording the %s notification: %s", event, err)
+	}
+}
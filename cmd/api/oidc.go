@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/oidc"
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// returns the url of the provider's login page, the frontend redirects the user there
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := app.oidcProviders.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	codeVerifier, err := oidc.RandomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	loginState := &store.OIDCLoginState{
+		State:        state,
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(app.config.oidc.stateExp),
+	}
+	if err := app.store.OIDCStates.Create(ctx, loginState); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	response := struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}{
+		AuthorizationURL: authURL,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type OIDCCallbackPayload struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := app.oidcProviders.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	var payload OIDCCallbackPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	loginState, err := app.store.OIDCStates.Consume(ctx, payload.State, provider.Name())
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.unauthorizedErrorResponse(w, r, errors.New("unknown oidc state"))
+		case store.Error_Expired:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tokenResponse, err := provider.Exchange(ctx, payload.Code, loginState.CodeVerifier)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, tokenResponse.IDToken, loginState.Nonce)
+	if err != nil {
+		if oidc.IsVerificationError(err) {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user, err := app.store.Users.GetByIdentity(ctx, provider.Name(), claims.Subject)
+	if err != nil {
+		if err != store.Error_NotFound {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		//linking by email is only safe if the provider vouches for the address
+		if claims.Email == "" || !claims.EmailVerified {
+			app.unauthorizedErrorResponse(w, r, oidc.Error_EmailNotVerified)
+			return
+		}
+
+		user, err = app.newOIDCUser(r, claims)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		identity := store.Identity{
+			Provider: provider.Name(),
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}
+		if err := app.store.Users.LinkOrCreateByIdentity(ctx, user, identity); err != nil {
+			switch err {
+			case store.Error_DuplicateUsername:
+				app.conflictResponse(w, r, err)
+			default:
+				app.storeErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		user, err = app.store.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	token, err := app.generateUserToken(user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// builds the user that gets created when nobody has registered with the email yet,
+// the password is random since these users always log in through the provider
+func (app *application) newOIDCUser(r *http.Request, claims *oidc.IDTokenClaims) (*store.User, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	localPart, _, _ := strings.Cut(claims.Email, "@")
+
+	user := &store.User{
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+		Username:  localPart + "_" + hex.EncodeToString(suffix),
+		Email:     claims.Email,
+		Role:      store.RoleCustomer,
+		Locale:    requestLocale(r),
+	}
+	if user.FirstName == "" {
+		user.FirstName = "Unknown"
+	}
+	if user.LastName == "" {
+		user.LastName = "Unknown"
+	}
+
+	randomPassword, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	if err := user.Password.Set(randomPassword); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+)
+
+type permission string
+
+const (
+	permAccessAdmin    permission = "admin:access"
+	permManageOwnSlots permission = "slots:manage_own"
+	permManageAllSlots permission = "slots:manage_all"
+	permManageRoles    permission = "users:manage_roles"
+	permInviteWorkers  permission = "workers:invite"
+	permUnlockAccounts permission = "users:unlock"
+	permManageEmails   permission = "emails:manage_templates"
+	permManageWebhooks permission = "webhooks:manage"
+)
+
+// every role gets the permissions of the roles below it
+var rolePermissions = map[string][]permission{
+	store.RoleCustomer: {},
+	store.RoleWorker: {
+		permAccessAdmin,
+		permManageOwnSlots,
+	},
+	store.RoleManager: {
+		permAccessAdmin,
+		permManageOwnSlots,
+		permManageAllSlots,
+		permInviteWorkers,
+		permUnlockAccounts,
+		permManageEmails,
+	},
+	store.RoleOwner: {
+		permAccessAdmin,
+		permManageOwnSlots,
+		permManageAllSlots,
+		permInviteWorkers,
+		permUnlockAccounts,
+		permManageEmails,
+		permManageRoles,
+		permManageWebhooks,
+	},
+}
+
+func hasPermission(role string, p permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// slotWorkerFilter returns nil when the user may act on every worker's slots,
+// otherwise the id the store should restrict the query to
+func slotWorkerFilter(user *store.User) *int64 {
+	if hasPermission(user.Role, permManageAllSlots) {
+		return nil
+	}
+	return &user.ID
+}
+
+func (app *application) RequirePermission(p permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getUserFromContext(r)
+			if user == nil || !hasPermission(user.Role, p) {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/notifier"
+	"github.com/MisterDodik/Barbershop/internal/store"
+)
+
+type PhonePayload struct {
+	Phone string `json:"phone" validate:"required,e164"`
+}
+
+// requestPhoneVerification texts a code to the phone, the number is only saved once the code comes back.
+// Codes are throttled per user and per phone so the endpoint can't be used to flood a number with texts.
+func (app *application) requestPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	var payload PhonePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	retryAt, err := app.store.PhoneVerifications.CreateRequest(ctx, user.ID, payload.Phone, code, app.config.sms.codeExp, app.config.sms.codeCooldown)
+	if err != nil {
+		switch err {
+		case store.Error_TooManyCodeRequests:
+			app.rateLimitExceededResponse(w, r, time.Until(*retryAt).Round(time.Second).String())
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	expiresIn, err := formatDurationFromString(app.config.sms.codeExp.String())
+	if err != nil {
+		expiresIn = app.config.sms.codeExp.String()
+	}
+	vars := struct {
+		BarbershopName string
+		Code           string
+		ExpiresIn      string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Code:           code,
+		ExpiresIn:      expiresIn,
+	}
+	if err := app.notifier.Text(ctx, "phone_verification.tmpl", user.Locale, payload.Phone, vars); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, "verification code sent"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type VerifyPhonePayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+func (app *application) verifyPhone(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyPhonePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	phone, err := app.store.PhoneVerifications.Verify(r.Context(), user.ID, payload.Code)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		case store.Error_InvalidCode, store.Error_Expired:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	user.Phone = &phone
+	user.PhoneVerifiedAt = &now
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) removePhone(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.store.Users.RemovePhone(r.Context(), user.ID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	user.Phone = nil
+	user.PhoneVerifiedAt = nil
+	user.NotificationChannel = notifier.ChannelEmail
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type NotificationChannelPayload struct {
+	Channel string `json:"channel" validate:"required,oneof=email sms both"`
+}
+
+// texts need a verified phone, emails are always possible
+func (app *application) updateNotificationChannel(w http.ResponseWriter, r *http.Request) {
+	var payload NotificationChannelPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Users.UpdateNotificationChannel(r.Context(), user.ID, payload.Channel); err != nil {
+		switch err {
+		case store.Error_PhoneNotVerified:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.NotificationChannel = payload.Channel
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
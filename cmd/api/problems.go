@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+// stable codes the frontend can rely on, the detail text may change
+const (
+	codeInternalError     = "internal_error"
+	codeBadRequest        = "bad_request"
+	codeInvalidJSON       = "invalid_json"
+	codeInvalidParameter  = "invalid_parameter"
+	codeValidationFailed  = "validation_failed"
+	codeNotFound          = "not_found"
+	codeConflict          = "conflict"
+	codeForbidden         = "forbidden"
+	codeUnauthorized      = "unauthorized"
+	codeRateLimited       = "rate_limited"
+	codeAccountLocked     = "account_locked"
+	codeRetry             = "retry"
+	codeDuplicateEmail    = "duplicate_email"
+	codeDuplicateUsername = "duplicate_username"
+	codeSlotOverlap       = "slot_overlap"
+	codeInvalidTransition = "invalid_transition"
+	codeNotStarted        = "not_started"
+	codeTooLateToChange   = "too_late_to_change"
+	codeExpired           = "expired"
+	codeInvalidReference  = "invalid_reference"
+	codeInvalidValue      = "invalid_value"
+	codeInvalidCode       = "invalid_code"
+	codePhoneNotVerified  = "phone_not_verified"
+)
+
+// store errors with a code of their own, the rest get the code of their status
+var errorCodes = map[error]string{
+	store.Error_Conflict:          codeConflict,
+	store.Error_Retry:             codeRetry,
+	store.Error_DuplicateEmail:    codeDuplicateEmail,
+	store.Error_DuplicateUsername: codeDuplicateUsername,
+	store.Error_SlotOverlap:       codeSlotOverlap,
+	store.Error_InvalidTransition: codeInvalidTransition,
+	store.Error_NotStarted:        codeNotStarted,
+	store.Error_TooLateToChange:   codeTooLateToChange,
+	store.Error_Expired:           codeExpired,
+	store.Error_InvalidReference:  codeInvalidReference,
+	store.Error_InvalidValue:      codeInvalidValue,
+	store.Error_InvalidCode:       codeInvalidCode,
+	store.Error_PhoneNotVerified:  codePhoneNotVerified,
+}
+
+func errorCode(err error, fallback string) string {
+	if code, ok := errorCodes[err]; ok {
+		return code
+	}
+	return fallback
+}
+
+// describeError gives a store error its code and translated message,
+// any other error keeps its own text under the fallback code
+func describeError(r *http.Request, err error, fallback string) (code, detail string) {
+	if code, ok := errorCodes[err]; ok {
+		return code, localizedMessage(r, code, err.Error())
+	}
+	return fallback, err.Error()
+}
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError points at the request field that failed, Code is the validation rule it broke
+type FieldError struct {
+	Field string `json:"field"`
+	Code  string `json:"code"`
+	Param string `json:"param,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string, fieldErrors []FieldError) error {
+	problem := &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+		Errors:    fieldErrors,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Content-Language", requestLocale(r))
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(problem)
+}
+
+// describeBadRequest turns a decode, parse or validation error into a problem the client can act on
+// without passing along the library's own error text
+func describeBadRequest(err error) (code, detail string, fieldErrors []FieldError) {
+	var (
+		validationErrors validator.ValidationErrors
+		syntaxErr        *json.SyntaxError
+		typeErr          *json.UnmarshalTypeError
+		maxBytesErr      *http.MaxBytesError
+		numErr           *strconv.NumError
+	)
+
+	switch {
+	case errors.As(err, &validationErrors):
+		for _, fieldErr := range validationErrors {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field: fieldPath(fieldErr.Namespace()),
+				Code:  fieldErr.Tag(),
+				Param: fieldErr.Param(),
+			})
+		}
+		return codeValidationFailed, "some fields are invalid", fieldErrors
+	case errors.As(err, &typeErr):
+		fieldErrors = []FieldError{{Field: typeErr.Field, Code: "type", Param: typeErr.Type.String()}}
+		return codeValidationFailed, "some fields have the wrong type", fieldErrors
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return codeInvalidJSON, "the body isn't valid JSON", nil
+	case errors.Is(err, io.EOF):
+		return codeInvalidJSON, "the body is empty", nil
+	case errors.As(err, &maxBytesErr):
+		return codeInvalidJSON, "the body is too large", nil
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return codeValidationFailed, "the body has an unknown field", []FieldError{{Field: field, Code: "unknown"}}
+	case errors.As(err, &numErr):
+		return codeInvalidParameter, "a parameter isn't a valid number", nil
+	default:
+		return errorCode(err, codeBadRequest), err.Error(), nil
+	}
+}
+
+// fieldPath drops the payload struct name from a validator namespace, "Payload.guest.email" becomes "guest.email"
+func fieldPath(namespace string) string {
+	if _, path, found := strings.Cut(namespace, "."); found {
+		return path
+	}
+	return namespace
+}
+
+// jsonFieldName makes the validator report fields by the name the client sent them under
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/google/uuid"
+)
+
+type UpdateProfilePayload struct {
+	FirstName *string `json:"first_name" validate:"omitempty,min=1,max=100"`
+	LastName  *string `json:"last_name" validate:"omitempty,min=1,max=100"`
+	Username  *string `json:"username" validate:"omitempty,min=1,max=100"`
+	Locale    *string `json:"locale" validate:"omitempty,oneof=bs en de"`
+}
+
+func (app *application) updateMyProfile(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.Locale != nil {
+		user.Locale = *payload.Locale
+	}
+
+	if err := app.store.Users.UpdateProfile(r.Context(), user); err != nil {
+		switch err {
+		case store.Error_DuplicateUsername:
+			app.conflictResponse(w, r, err)
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ChangeEmailPayload struct {
+	NewEmail string `json:"new_email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// the email only changes once the link sent to the new address is opened,
+// the old address gets a notice so a hijacked session can't silently take over the account
+func (app *application) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeEmailPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if !user.Password.ComparePasswords(payload.Password) {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("incorrect password"))
+		return
+	}
+
+	ctx := r.Context()
+	plainToken := uuid.New().String()
+
+	if err := app.store.EmailChanges.CreateRequest(ctx, user.ID, payload.NewEmail, plainToken, app.config.mail.exp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	isProdEnv := app.config.env == "production"
+	confirmURL := fmt.Sprintf("%s/confirm-email?token=%s", app.config.frontEndURL, plainToken)
+	confirmVars := struct {
+		BarbershopName string
+		Username       string
+		ConfirmURL     string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       user.Username,
+		ConfirmURL:     confirmURL,
+	}
+	statusCode, err := app.mailer.Send("email_change_confirm.tmpl", user.Locale, user.Username, payload.NewEmail, confirmVars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		if err := app.store.EmailChanges.DeleteRequest(ctx, user.ID); err != nil {
+			log.Printf("error deleting the email change request: %s", err)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	noticeVars := struct {
+		BarbershopName string
+		Username       string
+		NewEmail       string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       user.Username,
+		NewEmail:       payload.NewEmail,
+	}
+	statusCode, err = app.mailer.Send("email_change_notice.tmpl", user.Locale, user.Username, user.Email, noticeVars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured while sending an email", err)
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, "confirmation email sent"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ConfirmEmailChangePayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (app *application) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var payload ConfirmEmailChangePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.EmailChanges.Confirm(r.Context(), payload.Token); err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.badRequestResponse(w, r, err)
+		case store.Error_Expired:
+			app.badRequestResponse(w, r, err)
+		case store.Error_DuplicateEmail:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, "email updated"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	NewPassword     string `json:"new_password" validate:"required,max=72"`
+}
+
+// changes the password and logs out every other session, the response carries a fresh token for this one
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	var payload ChangePasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if !user.Password.ComparePasswords(payload.CurrentPassword) {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("incorrect password"))
+		return
+	}
+
+	if err := app.passwordPolicy.Validate(payload.NewPassword, user.Username, user.Email, user.FirstName, user.LastName); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	newPassword := store.User{}
+	if err := newPassword.Password.Set(payload.NewPassword); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	validAfter := time.Now().Truncate(time.Second)
+	if err := app.store.PasswordManager.ChangePassword(r.Context(), user.ID, newPassword.Password, validAfter); err != nil {
+		switch err {
+		case store.Error_SamePassword:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		BarbershopName string
+		Username       string
+		ChangedAt      time.Time
+		ResetURL       string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       user.Username,
+		ChangedAt:      validAfter,
+		ResetURL:       fmt.Sprintf("%s/forgot-password", app.config.frontEndURL),
+	}
+	statusCode, err := app.mailer.Send("password_changed.tmpl", user.Locale, user.Username, user.Email, vars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured while sending an email", err)
+	}
+
+	token, err := app.generateUserToken(user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.jsonResponse(w, http.StatusOK, token); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -27,14 +27,16 @@ func (app *application) RemoveSlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.store.TimeSlots.RemoveSlot(r.Context(), slotID)
+	worker := getUserFromContext(r)
+
+	err = app.store.TimeSlots.RemoveSlot(r.Context(), slotID, slotWorkerFilter(worker))
 	if err != nil {
 		switch err {
 		case store.Error_NotFound:
 			app.notFoundResponse(w, r, fmt.Errorf("no changes have been made"))
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -72,7 +74,12 @@ func (app *application) AddCustomSlot(w http.ResponseWriter, r *http.Request) {
 
 	closestAvailable, err := app.store.TimeSlots.CreateNewSlot(r.Context(), workerID, startTime, duration)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch err {
+		case store.Error_SlotOverlap:
+			app.conflictResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
 		return
 	}
 	if closestAvailable != nil {
@@ -148,6 +155,10 @@ func (app *application) parseWorkingHours(ctx context.Context, workerID int64, w
 			}
 
 			newTime, err := app.store.TimeSlots.CreateNewSlot(ctx, workerID, appointment, duration)
+			if err == store.Error_SlotOverlap {
+				//a slot was created concurrently, the next try finds it and suggests the time after it
+				continue
+			}
 			if err != nil {
 				return err
 			}
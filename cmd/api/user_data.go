@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+)
+
+func (app *application) exportMyData(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	export, err := app.store.UserData.Export(r.Context(), user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-export-%s.json", user.Username, time.Now().Format(time.DateOnly))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := app.jsonResponse(w, http.StatusOK, export); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// the account is only anonymised after the grace period, until then the user can log in and cancel
+func (app *application) deleteMyAccount(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	requestedAt, err := app.store.UserData.ScheduleDeletion(r.Context(), user.ID)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+	deletionAt := requestedAt.Add(app.config.cleanup.deletionGrace)
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		BarbershopName string
+		Username       string
+		DeletionDate   time.Time
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Username:       user.Username,
+		DeletionDate:   deletionAt,
+	}
+	statusCode, err := app.mailer.Send("account_deletion_scheduled.tmpl", user.Locale, user.Username, user.Email, vars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured while sending an email", err)
+	}
+
+	response := struct {
+		DeletionAt time.Time `json:"deletion_at"`
+	}{
+		DeletionAt: deletionAt,
+	}
+	if err := app.jsonResponse(w, http.StatusAccepted, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) cancelMyAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.store.UserData.CancelDeletion(r.Context(), user.ID); err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, "account deletion canceled"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
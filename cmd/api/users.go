@@ -16,7 +16,8 @@ type userKey string
 const userCtx userKey = "user"
 
 func getUserFromContext(r *http.Request) *store.User {
-	return r.Context().Value(userCtx).(*store.User)
+	user, _ := r.Context().Value(userCtx).(*store.User)
+	return user
 }
 
 func (app *application) getMyInfo(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +30,7 @@ func (app *application) getMyInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 type NewPasswordPayload struct {
-	NewPassword string `json:"new_password" validate:"required,min=3,max=72"`
+	NewPassword string `json:"new_password" validate:"required,max=72"`
 	Token       string `json:"token" validate:"required"`
 }
 
@@ -46,13 +47,30 @@ func (app *application) updatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := r.Context()
+	resetUser, err := app.store.PasswordManager.GetUserByResetToken(ctx, payload.Token)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.passwordPolicy.Validate(payload.NewPassword, resetUser.Username, resetUser.Email, resetUser.FirstName, resetUser.LastName); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	user := store.User{}
 
 	if err := user.Password.Set(payload.NewPassword); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	userID, err := app.store.PasswordManager.UpdatePassword(r.Context(), user.Password, payload.Token)
+	userID, err := app.store.PasswordManager.UpdatePassword(ctx, user.Password, payload.Token)
 	if err != nil {
 		switch err {
 		case store.Error_NotFound:
@@ -65,11 +83,11 @@ func (app *application) updatePassword(w http.ResponseWriter, r *http.Request) {
 			app.badRequestResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
-	if err := app.store.PasswordManager.DeleteResetPasswordRequest(r.Context(), *userID); err != nil {
+	if err := app.store.PasswordManager.DeleteResetPasswordRequest(ctx, *userID); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -103,7 +121,7 @@ func (app *application) requestPasswordReset(w http.ResponseWriter, r *http.Requ
 			app.notFoundResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -119,7 +137,7 @@ func (app *application) requestPasswordReset(w http.ResponseWriter, r *http.Requ
 		case store.Error_TableNotUpdated:
 			app.internalServerError(w, r, err)
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 		}
 		return
 	}
@@ -135,7 +153,7 @@ func (app *application) requestPasswordReset(w http.ResponseWriter, r *http.Requ
 		ResetURL:       resetURL,
 		BarbershopName: app.config.BarbershopName,
 	}
-	statusCode, err := app.mailer.Send("reset_password.tmpl", user.Username, payload.Email, vars, isProdEnv)
+	statusCode, err := app.mailer.Send("reset_password.tmpl", user.Locale, user.Username, payload.Email, vars, isProdEnv)
 	if err != nil && statusCode != http.StatusAccepted {
 		err = app.store.PasswordManager.DeleteResetPasswordRequest(r.Context(), user.ID)
 		if err != nil {
@@ -162,7 +180,7 @@ func (app *application) getMyAppointments(w http.ResponseWriter, r *http.Request
 			app.notFoundResponse(w, r, err)
 			return
 		default:
-			app.internalServerError(w, r, err)
+			app.storeErrorResponse(w, r, err)
 			return
 		}
 	}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/MisterDodik/Barbershop/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateWebhookPayload struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,unique,dive,oneof=appointment.booked appointment.cancelled appointment.status_changed user.registered"`
+}
+
+// fields left out of the payload keep their value
+type UpdateWebhookPayload struct {
+	URL      *string   `json:"url" validate:"omitempty,http_url,max=2048"`
+	Events   *[]string `json:"events" validate:"omitempty,min=1,unique,dive,oneof=appointment.booked appointment.cancelled appointment.status_changed user.registered"`
+	IsActive *bool     `json:"is_active"`
+}
+
+type WebhookDeliveryQueryParams struct {
+	Status string `validate:"omitempty,oneof=pending sent failed"`
+	Limit  int    `validate:"min=1,max=100"`
+	Offset int    `validate:"min=0"`
+}
+
+func (app *application) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := app.store.Webhooks.ListSubscriptions(r.Context())
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, subscriptions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// createWebhook generates the signing secret, it's only returned here so the subscriber has to store it
+func (app *application) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload CreateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := webhooks.CheckURL(r.Context(), payload.URL); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	subscription := &store.WebhookSubscription{
+		URL:       payload.URL,
+		Secret:    "whsec_" + hex.EncodeToString(secret),
+		Events:    payload.Events,
+		IsActive:  true,
+		CreatedBy: &user.ID,
+	}
+	if err := app.store.Webhooks.CreateSubscription(r.Context(), subscription); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, subscription); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload UpdateWebhookPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if payload.URL != nil {
+		if err := webhooks.CheckURL(ctx, *payload.URL); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	subscription, err := app.store.Webhooks.GetSubscription(ctx, webhookID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+	if payload.URL != nil {
+		subscription.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		subscription.Events = *payload.Events
+	}
+	if payload.IsActive != nil {
+		subscription.IsActive = *payload.IsActive
+	}
+
+	if err := app.store.Webhooks.UpdateSubscription(ctx, subscription); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, subscription); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Webhooks.DeleteSubscription(r.Context(), webhookID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, nil); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// ?status=pending|sent|failed&limit=&offset=
+func (app *application) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "webhookID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := WebhookDeliveryQueryParams{
+		Status: query.Get("status"),
+		Limit:  20,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid limit"))
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if params.Offset, err = strconv.Atoi(offset); err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid offset"))
+			return
+		}
+	}
+
+	if err := Validate.Struct(params); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	//a subscription without deliveries and one that doesn't exist shouldn't look the same
+	if _, err := app.store.Webhooks.GetSubscription(ctx, webhookID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	deliveries, err := app.store.Webhooks.ListDeliveries(ctx, store.WebhookDeliveryQuery{
+		SubscriptionID: webhookID,
+		Status:         params.Status,
+		Limit:          params.Limit,
+		Offset:         params.Offset,
+	})
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, deliveries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deliverWebhooks sends the due deliveries in parallel, a failed one is tried again later
+// until it runs out of attempts
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	due, err := app.store.Webhooks.ClaimDue(ctx, app.config.webhooks.batchSize, app.config.webhooks.lease)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for i := range due {
+		wg.Add(1)
+		go func(delivery *store.WebhookDelivery) {
+			defer wg.Done()
+			app.deliverWebhook(ctx, delivery)
+		}(&due[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+func (app *application) deliverWebhook(ctx context.Context, delivery *store.WebhookDelivery) {
+	statusCode, err := app.webhooks.Send(ctx, delivery.URL, delivery.Secret, delivery.ID, delivery.Event, delivery.Payload)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = nil
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+	switch {
+	case err == nil:
+		delivery.Status = store.DeliverySent
+		delivery.LastError = ""
+		delivery.NextAttemptAt = time.Now()
+	case delivery.Attempts >= webhooks.MaxAttempts:
+		delivery.Status = store.DeliveryFailed
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now()
+	default:
+		delivery.Status = store.DeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(webhooks.Backoff(delivery.Attempts))
+	}
+
+	//the lease runs out when this fails, so the delivery is sent again
+	if err := app.store.Webhooks.RecordAttempt(ctx, delivery); err != nil {
+		log.Printf("could not record webhook delivery %d: %s", delivery.ID, err)
+	}
+}
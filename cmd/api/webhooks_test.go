@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/MisterDodik/Barbershop/internal/webhooks"
+)
+
+// recordingWebhooks keeps the attempts deliverWebhook records, the rest of the storage isn't used
+type recordingWebhooks struct {
+	recorded []store.WebhookDelivery
+}
+
+func (s *recordingWebhooks) CreateSubscription(context.Context, *store.WebhookSubscription) error {
+	return nil
+}
+func (s *recordingWebhooks) GetSubscription(context.Context, int64) (*store.WebhookSubscription, error) {
+	return nil, store.Error_NotFound
+}
+func (s *recordingWebhooks) ListSubscriptions(context.Context) ([]store.WebhookSubscription, error) {
+	return nil, nil
+}
+func (s *recordingWebhooks) UpdateSubscription(context.Context, *store.WebhookSubscription) error {
+	return nil
+}
+func (s *recordingWebhooks) DeleteSubscription(context.Context, int64) error {
+	return nil
+}
+func (s *recordingWebhooks) ListDeliveries(context.Context, store.WebhookDeliveryQuery) (*store.WebhookDeliveryList, error) {
+	return nil, nil
+}
+func (s *recordingWebhooks) ClaimDue(context.Context, int, time.Duration) ([]store.WebhookDelivery, error) {
+	return nil, nil
+}
+func (s *recordingWebhooks) RecordAttempt(_ context.Context, delivery *store.WebhookDelivery) error {
+	s.recorded = append(s.recorded, *delivery)
+	return nil
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "subscriber is down", http.StatusBadGateway)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		attempts    int
+		wantStatus  string
+		wantCode    int //0 when the subscriber didn't answer
+		wantBackoff bool
+		wantNoError bool
+	}{
+		{"delivered", server.URL + "/ok", 0, store.DeliverySent, http.StatusOK, false, true},
+		{"delivered on a retry", server.URL + "/ok", 3, store.DeliverySent, http.StatusOK, false, true},
+		{"an error status is tried again", server.URL + "/error", 0, store.DeliveryPending, http.StatusBadGateway, true, false},
+		{"no answer is tried again", closed.URL, 2, store.DeliveryPending, 0, true, false},
+		{"the last attempt fails for good", server.URL + "/error", webhooks.MaxAttempts - 1, store.DeliveryFailed, http.StatusBadGateway, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &recordingWebhooks{}
+			app := &application{
+				store:    store.Storage{Webhooks: recorder},
+				webhooks: webhooks.NewSender(server.Client()),
+			}
+
+			before := time.Now()
+			app.deliverWebhook(context.Background(), &store.WebhookDelivery{
+				ID:       1,
+				Event:    store.WebhookUserRegistered,
+				Payload:  []byte(`{}`),
+				Status:   store.DeliveryPending,
+				Attempts: test.attempts,
+				URL:      test.url,
+				Secret:   "whsec_test",
+			})
+
+			if len(recorder.recorded) != 1 {
+				t.Fatalf("%d attempts were recorded, want one", len(recorder.recorded))
+			}
+			delivery := recorder.recorded[0]
+
+			if delivery.Status != test.wantStatus || delivery.Attempts != test.attempts+1 {
+				t.Fatalf("got %s after %d attempts, want %s after %d", delivery.Status, delivery.Attempts, test.wantStatus, test.attempts+1)
+			}
+			switch {
+			case test.wantCode == 0 && delivery.LastStatusCode != nil:
+				t.Fatalf("status code %d recorded without an answer", *delivery.LastStatusCode)
+			case test.wantCode != 0 && (delivery.LastStatusCode == nil || *delivery.LastStatusCode != test.wantCode):
+				t.Fatalf("status code %v, want %d", delivery.LastStatusCode, test.wantCode)
+			}
+			if (delivery.LastError == "") != test.wantNoError {
+				t.Fatalf("last error %q", delivery.LastError)
+			}
+
+			wait := delivery.NextAttemptAt.Sub(before)
+			wantWait := time.Duration(0)
+			if test.wantBackoff {
+				wantWait = webhooks.Backoff(test.attempts + 1)
+			}
+			if wait < wantWait || wait > wantWait+time.Second*5 {
+				t.Fatalf("next attempt in %s, want %s", wait, wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/store"
+	"github.com/google/uuid"
+)
+
+type WorkerInvitationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+	Shop  string `json:"shop" validate:"omitempty,max=255"`
+}
+
+func (app *application) inviteWorker(w http.ResponseWriter, r *http.Request) {
+	var payload WorkerInvitationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	inviter := getUserFromContext(r)
+
+	invitation := &store.WorkerInvitation{
+		Email:     payload.Email,
+		Shop:      payload.Shop,
+		InvitedBy: inviter.ID,
+		ExpiresAt: time.Now().Add(app.config.mail.workerInvitationExp),
+	}
+	if invitation.Shop == "" {
+		invitation.Shop = app.config.BarbershopName
+	}
+
+	plainToken := uuid.New().String()
+	ctx := r.Context()
+
+	if err := app.store.WorkerInvitations.Create(ctx, invitation, plainToken); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	invitationURL := fmt.Sprintf("%s/worker-invitation?token=%s", app.config.frontEndURL, plainToken)
+	expiresIn, err := formatDurationFromString(app.config.mail.workerInvitationExp.String())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		BarbershopName string
+		Shop           string
+		InvitedBy      string
+		InvitationURL  string
+		ExpiresIn      string
+	}{
+		BarbershopName: app.config.BarbershopName,
+		Shop:           invitation.Shop,
+		InvitedBy:      inviter.FirstName,
+		InvitationURL:  invitationURL,
+		ExpiresIn:      expiresIn,
+	}
+
+	statusCode, err := app.mailer.Send("worker_invitation.tmpl", requestLocale(r), payload.Email, payload.Email, vars, isProdEnv)
+	if err != nil && statusCode != http.StatusAccepted {
+		log.Printf("an error %s occured. Deleting worker invitation from the database", err)
+		if err := app.store.WorkerInvitations.Delete(ctx, plainToken); err != nil {
+			log.Printf("error deleting the worker invitation: %s", err)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, "invitation sent"); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// the account fields are only needed when nobody is registered with the invited email yet,
+// or the account registered with it was never activated
+type AcceptWorkerInvitationPayload struct {
+	Token     string `json:"token" validate:"required"`
+	FirstName string `json:"first_name" validate:"required_with=Password,max=100"`
+	LastName  string `json:"last_name" validate:"required_with=Password,max=100"`
+	Username  string `json:"username" validate:"required_with=Password,max=100"`
+	Password  string `json:"password" validate:"omitempty,max=72"`
+}
+
+func (app *application) acceptWorkerInvitation(w http.ResponseWriter, r *http.Request) {
+	var payload AcceptWorkerInvitationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var newUser *store.User
+	if payload.Password != "" {
+		invitation, err := app.store.WorkerInvitations.Get(r.Context(), payload.Token)
+		if err != nil {
+			app.storeErrorResponse(w, r, err)
+			return
+		}
+		if err := app.passwordPolicy.Validate(payload.Password, payload.Username, invitation.Email, payload.FirstName, payload.LastName); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		newUser = &store.User{
+			FirstName: payload.FirstName,
+			LastName:  payload.LastName,
+			Username:  payload.Username,
+		}
+		if err := newUser.Password.Set(payload.Password); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	user, err := app.store.WorkerInvitations.Accept(r.Context(), payload.Token, newUser)
+	if err != nil {
+		switch err {
+		case store.Error_NotFound:
+			app.notFoundResponse(w, r, err)
+		case store.Error_Expired:
+			app.badRequestResponse(w, r, err)
+		case store.Error_AccountRequired:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response := struct {
+		UserID int64  `json:"user_id"`
+		Role   string `json:"role"`
+	}{
+		UserID: user.ID,
+		Role:   user.Role,
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
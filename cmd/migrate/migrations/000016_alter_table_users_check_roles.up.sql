@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS users
+ADD CONSTRAINT users_roles_check CHECK (roles IN ('customer', 'worker', 'manager', 'owner'));
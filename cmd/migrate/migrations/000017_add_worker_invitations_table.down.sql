@@ -0,0 +1 @@
+DROP TABLE IF EXISTS worker_invitations;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS worker_invitations (
+    token TEXT PRIMARY KEY,
+    email CITEXT NOT NULL,
+    shop VARCHAR(255) NOT NULL,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS failed_logins (
+    id BIGSERIAL PRIMARY KEY,
+    email CITEXT NOT NULL,
+    ip TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_failed_logins_email ON failed_logins (email, created_at);
+CREATE INDEX IF NOT EXISTS idx_failed_logins_ip ON failed_logins (ip, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN locked_until TIMESTAMP(0) WITH TIME ZONE;
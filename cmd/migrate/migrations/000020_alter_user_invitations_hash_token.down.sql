@@ -0,0 +1,8 @@
+ALTER TABLE user_invitations
+DROP CONSTRAINT IF EXISTS fk_user_invitations_user;
+
+-- hashed tokens can't be turned back into uuids
+DELETE FROM user_invitations;
+
+ALTER TABLE user_invitations
+ALTER COLUMN token TYPE UUID USING token::uuid;
@@ -0,0 +1,8 @@
+ALTER TABLE user_invitations
+ALTER COLUMN token TYPE TEXT USING encode(sha256(token::text::bytea), 'hex');
+
+DELETE FROM user_invitations i
+WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = i.user_id);
+
+ALTER TABLE user_invitations
+ADD CONSTRAINT fk_user_invitations_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN tokens_valid_after TIMESTAMP(0) WITH TIME ZONE;
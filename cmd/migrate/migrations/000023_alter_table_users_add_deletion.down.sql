@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS users
+DROP COLUMN deletion_requested_at,
+DROP COLUMN deleted_at;
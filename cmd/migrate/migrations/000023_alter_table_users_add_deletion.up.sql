@@ -0,0 +1,3 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN deletion_requested_at TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN deleted_at TIMESTAMP(0) WITH TIME ZONE;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS customer_notes;
\ No newline at end of file
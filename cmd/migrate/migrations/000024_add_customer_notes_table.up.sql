@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS customer_notes (
+    customer_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    notes TEXT NOT NULL DEFAULT '',
+    allergies TEXT NOT NULL DEFAULT '',
+    preferred_style TEXT NOT NULL DEFAULT '',
+    updated_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
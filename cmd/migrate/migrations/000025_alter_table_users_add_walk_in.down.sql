@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_users_phone;
+
+DELETE FROM users WHERE email IS NULL;
+
+ALTER TABLE IF EXISTS users
+ALTER COLUMN email SET NOT NULL;
+
+ALTER TABLE IF EXISTS users
+DROP COLUMN phone,
+DROP COLUMN is_walk_in;
@@ -0,0 +1,9 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN phone VARCHAR(32),
+ADD COLUMN is_walk_in BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- walk-in customers don't always leave an email
+ALTER TABLE IF EXISTS users
+ALTER COLUMN email DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_phone ON users (phone);
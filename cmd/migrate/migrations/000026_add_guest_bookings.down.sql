@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS guest_booking_requests;
+
+UPDATE time_slots SET is_booked = FALSE, status = 'available'
+WHERE status = 'pending';
+
+ALTER TABLE IF EXISTS time_slots
+DROP COLUMN hold_expires_at;
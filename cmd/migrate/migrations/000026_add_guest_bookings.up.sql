@@ -0,0 +1,13 @@
+-- a guest booking holds the slot as 'pending' until the emailed link is opened
+ALTER TABLE IF EXISTS time_slots
+ADD COLUMN hold_expires_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS guest_booking_requests (
+    token TEXT PRIMARY KEY,
+    slot_id BIGINT NOT NULL REFERENCES time_slots(id) ON DELETE CASCADE,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    email CITEXT NOT NULL,
+    phone VARCHAR(32) NOT NULL,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
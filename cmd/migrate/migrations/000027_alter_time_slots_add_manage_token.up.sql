@@ -0,0 +1,3 @@
+-- hashed token of the link a customer uses to manage the booking without logging in
+ALTER TABLE IF EXISTS time_slots
+ADD COLUMN manage_token TEXT UNIQUE;
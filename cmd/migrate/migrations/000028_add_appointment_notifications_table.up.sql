@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS appointment_notifications (
+    id BIGSERIAL PRIMARY KEY,
+    slot_id BIGINT REFERENCES time_slots(id) ON DELETE SET NULL,
+    event VARCHAR(32) NOT NULL,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    recipient_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL DEFAULT '',
+    delivery VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_notifications_slot ON appointment_notifications (slot_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS appointment_events;
+
+UPDATE time_slots SET status = 'booked' WHERE status = 'in_progress';
+
+ALTER TABLE IF EXISTS time_slots
+DROP CONSTRAINT IF EXISTS time_slots_status_check;
@@ -0,0 +1,17 @@
+ALTER TABLE IF EXISTS time_slots
+ADD CONSTRAINT time_slots_status_check CHECK (status IN (
+    'available', 'pending', 'booked', 'in_progress', 'completed', 'missed'
+));
+
+CREATE TABLE IF NOT EXISTS appointment_events (
+    id BIGSERIAL PRIMARY KEY,
+    slot_id BIGINT NOT NULL REFERENCES time_slots(id) ON DELETE CASCADE,
+    customer_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    from_status VARCHAR(32) NOT NULL,
+    to_status VARCHAR(32) NOT NULL,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_events_slot ON appointment_events (slot_id);
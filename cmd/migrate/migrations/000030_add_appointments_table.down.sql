@@ -0,0 +1,39 @@
+ALTER TABLE IF EXISTS time_slots
+ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN status VARCHAR(255) NOT NULL DEFAULT 'available',
+ADD COLUMN manage_token TEXT UNIQUE,
+ADD COLUMN hold_expires_at TIMESTAMP(0) WITH TIME ZONE,
+ADD CONSTRAINT time_slots_status_check CHECK (status IN (
+    'available', 'pending', 'booked', 'in_progress', 'completed', 'missed'
+));
+
+UPDATE time_slots t
+SET user_id = a.customer_id, status = a.status, manage_token = a.manage_token, hold_expires_at = a.hold_expires_at
+FROM appointments a
+WHERE a.slot_id = t.id AND a.status NOT IN ('cancelled_by_customer', 'cancelled_by_shop', 'expired');
+
+ALTER TABLE IF EXISTS guest_booking_requests
+ADD COLUMN slot_id BIGINT REFERENCES time_slots(id) ON DELETE CASCADE;
+
+UPDATE guest_booking_requests g SET slot_id = a.slot_id
+FROM appointments a
+WHERE a.id = g.appointment_id;
+
+DELETE FROM guest_booking_requests WHERE slot_id IS NULL;
+
+ALTER TABLE IF EXISTS guest_booking_requests
+ALTER COLUMN slot_id SET NOT NULL,
+DROP COLUMN appointment_id;
+
+ALTER TABLE IF EXISTS appointment_notifications
+DROP COLUMN appointment_id;
+
+DELETE FROM appointment_events WHERE slot_id IS NULL;
+
+ALTER TABLE IF EXISTS appointment_events
+DROP COLUMN appointment_id,
+ALTER COLUMN slot_id SET NOT NULL,
+DROP CONSTRAINT IF EXISTS appointment_events_slot_id_fkey,
+ADD CONSTRAINT appointment_events_slot_id_fkey FOREIGN KEY (slot_id) REFERENCES time_slots(id) ON DELETE CASCADE;
+
+DROP TABLE IF EXISTS appointments;
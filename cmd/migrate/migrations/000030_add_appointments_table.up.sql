@@ -0,0 +1,116 @@
+-- time_slots only describe a worker's availability from now on, bookings live in appointments
+-- so a cancelled appointment keeps who had booked it
+CREATE TABLE IF NOT EXISTS appointments (
+    id BIGSERIAL PRIMARY KEY,
+    slot_id BIGINT REFERENCES time_slots(id) ON DELETE SET NULL,
+    worker_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    customer_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    start_time TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    duration INTERVAL NOT NULL,
+    service VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(32) NOT NULL CHECK (status IN (
+        'pending', 'booked', 'in_progress', 'completed', 'missed',
+        'cancelled_by_customer', 'cancelled_by_shop', 'expired'
+    )),
+    manage_token TEXT UNIQUE,
+    hold_expires_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- a slot has at most one appointment that isn't cancelled
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_active_slot ON appointments (slot_id)
+WHERE status NOT IN ('cancelled_by_customer', 'cancelled_by_shop', 'expired');
+CREATE INDEX IF NOT EXISTS idx_appointments_customer ON appointments (customer_id);
+CREATE INDEX IF NOT EXISTS idx_appointments_worker_start ON appointments (worker_id, start_time);
+
+INSERT INTO appointments (slot_id, worker_id, customer_id, start_time, duration, status, manage_token, hold_expires_at)
+SELECT id, worker_id, user_id, start_time, duration, status, manage_token, hold_expires_at
+FROM time_slots
+WHERE is_booked = TRUE;
+
+ALTER TABLE IF EXISTS appointment_events
+ADD COLUMN appointment_id BIGINT REFERENCES appointments(id) ON DELETE CASCADE,
+ALTER COLUMN slot_id DROP NOT NULL,
+DROP CONSTRAINT IF EXISTS appointment_events_slot_id_fkey,
+ADD CONSTRAINT appointment_events_slot_id_fkey FOREIGN KEY (slot_id) REFERENCES time_slots(id) ON DELETE SET NULL;
+
+-- a slot could be booked, cancelled and booked again, so its events are split into bookings first.
+-- every booking starts with the event that took the slot from available.
+CREATE TEMPORARY TABLE event_bookings AS
+SELECT id AS event_id, slot_id,
+    SUM(CASE WHEN from_status = 'available' THEN 1 ELSE 0 END)
+        OVER (PARTITION BY slot_id ORDER BY created_at, id) AS booking
+FROM appointment_events;
+
+CREATE TEMPORARY TABLE past_bookings AS
+SELECT b.slot_id, b.booking,
+    (ARRAY_AGG(e.customer_id ORDER BY e.created_at, e.id))[1] AS customer_id,
+    -- a guest's hold that ran out took the slot back to available
+    REPLACE((ARRAY_AGG(e.to_status ORDER BY e.created_at DESC, e.id DESC))[1], 'available', 'expired') AS status,
+    MIN(e.created_at) AS created_at,
+    NULL::BIGINT AS appointment_id
+FROM event_bookings b
+JOIN appointment_events e ON e.id = b.event_id
+GROUP BY b.slot_id, b.booking;
+
+-- the latest booking of a slot is the one it holds now when the customer matches
+UPDATE past_bookings p SET appointment_id = a.id
+FROM appointments a
+WHERE a.slot_id = p.slot_id AND a.customer_id IS NOT DISTINCT FROM p.customer_id
+    AND p.booking = (SELECT MAX(booking) FROM past_bookings l WHERE l.slot_id = p.slot_id);
+
+-- every other booking becomes a historical appointment of its own, only the slot's current
+-- appointment may hold on to it
+UPDATE past_bookings SET appointment_id = nextval(pg_get_serial_sequence('appointments', 'id'))
+WHERE appointment_id IS NULL;
+
+INSERT INTO appointments (id, slot_id, worker_id, customer_id, start_time, duration, status, created_at, updated_at)
+SELECT p.appointment_id,
+    CASE WHEN p.status IN ('cancelled_by_customer', 'cancelled_by_shop', 'expired') THEN t.id END,
+    t.worker_id, p.customer_id, t.start_time, t.duration, p.status, p.created_at, p.created_at
+FROM past_bookings p
+JOIN time_slots t ON t.id = p.slot_id
+WHERE NOT EXISTS (SELECT 1 FROM appointments a WHERE a.id = p.appointment_id);
+
+UPDATE appointment_events e SET appointment_id = p.appointment_id
+FROM event_bookings b
+JOIN past_bookings p ON p.slot_id = b.slot_id AND p.booking = b.booking
+WHERE b.event_id = e.id;
+
+DROP TABLE event_bookings;
+
+CREATE INDEX IF NOT EXISTS idx_appointment_events_appointment ON appointment_events (appointment_id);
+
+ALTER TABLE IF EXISTS appointment_notifications
+ADD COLUMN appointment_id BIGINT REFERENCES appointments(id) ON DELETE CASCADE;
+
+-- a notification belongs to the booking whose event it was sent for
+UPDATE appointment_notifications n SET appointment_id = (
+    SELECT e.appointment_id FROM appointment_events e
+    WHERE e.slot_id = n.slot_id AND e.to_status = n.event AND e.created_at <= n.created_at
+    ORDER BY e.created_at DESC, e.id DESC
+    LIMIT 1
+)
+WHERE n.slot_id IS NOT NULL;
+
+DROP TABLE past_bookings;
+
+ALTER TABLE IF EXISTS guest_booking_requests
+ADD COLUMN appointment_id BIGINT REFERENCES appointments(id) ON DELETE CASCADE;
+
+UPDATE guest_booking_requests g SET appointment_id = a.id
+FROM appointments a
+WHERE a.slot_id = g.slot_id AND a.status = 'pending';
+
+DELETE FROM guest_booking_requests WHERE appointment_id IS NULL;
+
+ALTER TABLE IF EXISTS guest_booking_requests
+ALTER COLUMN appointment_id SET NOT NULL,
+DROP COLUMN slot_id;
+
+ALTER TABLE IF EXISTS time_slots
+DROP COLUMN user_id,
+DROP COLUMN status,
+DROP COLUMN manage_token,
+DROP COLUMN hold_expires_at;
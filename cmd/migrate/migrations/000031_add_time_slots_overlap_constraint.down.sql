@@ -0,0 +1,8 @@
+ALTER TABLE IF EXISTS time_slots
+DROP CONSTRAINT IF EXISTS time_slots_no_overlap;
+
+DROP TRIGGER IF EXISTS time_slots_set_end_time ON time_slots;
+DROP FUNCTION IF EXISTS set_time_slot_end_time();
+
+ALTER TABLE IF EXISTS time_slots
+DROP COLUMN IF EXISTS end_time;
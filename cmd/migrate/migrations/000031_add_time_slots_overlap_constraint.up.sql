@@ -0,0 +1,56 @@
+-- slots created before the constraint may already overlap. Two booked slots that overlap can't be
+-- resolved here without cancelling a customer's appointment, so the migration stops before changing
+-- anything until one of each pair is moved or cancelled by hand
+DO $$
+DECLARE
+    overlapping TEXT;
+BEGIN
+    SELECT string_agg(t.id || ' and ' || o.id, ', ') INTO overlapping
+    FROM time_slots t
+    JOIN time_slots o ON o.worker_id = t.worker_id AND o.id > t.id
+    WHERE t.is_booked AND o.is_booked
+        AND o.start_time < t.start_time + t.duration AND o.start_time + o.duration > t.start_time;
+
+    IF overlapping IS NOT NULL THEN
+        RAISE EXCEPTION 'booked time slots overlap: %', overlapping
+            USING HINT = 'move or cancel one appointment of each pair, run "migrate force 30" and migrate up again';
+    END IF;
+END $$;
+
+-- a free slot is removed when it overlaps a booked slot or an earlier created one,
+-- the worker's schedule generates free slots again
+DELETE FROM time_slots t
+USING time_slots o
+WHERE o.worker_id = t.worker_id AND o.id <> t.id AND t.is_booked = FALSE
+    AND o.start_time < t.start_time + t.duration AND o.start_time + o.duration > t.start_time
+    AND (o.is_booked OR o.id < t.id);
+
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- start_time + duration isn't immutable (it depends on the session time zone) so it can't be used
+-- in a constraint directly, the end of the slot is kept in its own column by a trigger instead
+ALTER TABLE IF EXISTS time_slots
+ADD COLUMN end_time TIMESTAMP(0) WITH TIME ZONE;
+
+UPDATE time_slots SET end_time = start_time + duration;
+
+ALTER TABLE IF EXISTS time_slots
+ALTER COLUMN end_time SET NOT NULL;
+
+CREATE OR REPLACE FUNCTION set_time_slot_end_time() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.end_time := NEW.start_time + NEW.duration;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER time_slots_set_end_time
+BEFORE INSERT OR UPDATE OF start_time, duration ON time_slots
+FOR EACH ROW EXECUTE FUNCTION set_time_slot_end_time();
+
+-- a worker can't have two slots that overlap, however concurrently they're created
+ALTER TABLE IF EXISTS time_slots
+ADD CONSTRAINT time_slots_no_overlap EXCLUDE USING gist (
+    worker_id WITH =,
+    tstzrange(start_time, end_time) WITH &&
+);
@@ -0,0 +1,6 @@
+ALTER TABLE IF EXISTS guest_booking_requests
+DROP COLUMN IF EXISTS locale;
+
+ALTER TABLE IF EXISTS users
+DROP CONSTRAINT IF EXISTS users_locale_check,
+DROP COLUMN IF EXISTS locale;
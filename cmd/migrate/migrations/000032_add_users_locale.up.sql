@@ -0,0 +1,7 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN locale VARCHAR(8) NOT NULL DEFAULT 'bs',
+ADD CONSTRAINT users_locale_check CHECK (locale IN ('bs', 'en', 'de'));
+
+-- the guest's language is kept until the booking is confirmed and the walk-in record created
+ALTER TABLE IF EXISTS guest_booking_requests
+ADD COLUMN locale VARCHAR(8) NOT NULL DEFAULT 'bs';
@@ -0,0 +1,10 @@
+-- overrides of the templates compiled into the binary, a missing row means the embedded one is sent
+CREATE TABLE IF NOT EXISTS email_templates (
+    name VARCHAR(100) NOT NULL,
+    locale VARCHAR(8) NOT NULL CHECK (locale IN ('bs', 'en', 'de')),
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    updated_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (name, locale)
+);
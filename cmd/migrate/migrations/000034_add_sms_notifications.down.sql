@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_appointments_unreminded;
+
+ALTER TABLE IF EXISTS appointments
+DROP COLUMN IF EXISTS reminded_at;
+
+DROP TABLE IF EXISTS phone_verifications;
+
+ALTER TABLE IF EXISTS users
+DROP CONSTRAINT IF EXISTS users_notification_channel_check,
+DROP COLUMN IF EXISTS notification_channel,
+DROP COLUMN IF EXISTS phone_verified_at;
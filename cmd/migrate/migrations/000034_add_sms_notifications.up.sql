@@ -0,0 +1,25 @@
+-- a phone only receives texts once the user typed in the code sent to it,
+-- walk-ins without an email count as verified because only the staff can create them
+ALTER TABLE IF EXISTS users
+ADD COLUMN phone_verified_at TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN notification_channel VARCHAR(8) NOT NULL DEFAULT 'email',
+ADD CONSTRAINT users_notification_channel_check CHECK (notification_channel IN ('email', 'sms', 'both'));
+
+UPDATE users SET phone_verified_at = NOW(), notification_channel = 'sms'
+WHERE is_walk_in = TRUE AND phone IS NOT NULL AND email IS NULL;
+
+CREATE TABLE IF NOT EXISTS phone_verifications (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    phone VARCHAR(32) NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- set when the reminder job picks the appointment up so it's reminded only once
+ALTER TABLE IF EXISTS appointments
+ADD COLUMN reminded_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_appointments_unreminded ON appointments (start_time)
+WHERE reminded_at IS NULL AND status = 'booked';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_phone_verifications_phone;
+
+ALTER TABLE IF EXISTS phone_verifications
+DROP COLUMN IF EXISTS window_started_at;
@@ -0,0 +1,9 @@
+-- wrong guesses count against the attempts from the first code sent in the window,
+-- resending a code doesn't give the attempts back
+ALTER TABLE IF EXISTS phone_verifications
+ADD COLUMN window_started_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+UPDATE phone_verifications SET window_started_at = created_at;
+
+-- codes sent to a phone are throttled whoever asks for them
+CREATE INDEX IF NOT EXISTS idx_phone_verifications_phone ON phone_verifications (phone, created_at);
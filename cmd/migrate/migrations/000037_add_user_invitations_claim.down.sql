@@ -0,0 +1,7 @@
+ALTER TABLE IF EXISTS user_invitations
+DROP COLUMN IF EXISTS claim_username,
+DROP COLUMN IF EXISTS claim_first_name,
+DROP COLUMN IF EXISTS claim_last_name,
+DROP COLUMN IF EXISTS claim_password,
+DROP COLUMN IF EXISTS claim_role,
+DROP COLUMN IF EXISTS claim_locale;
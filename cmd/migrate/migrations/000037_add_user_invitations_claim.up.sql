@@ -0,0 +1,9 @@
+-- a registration for the email of a walk-in keeps its details on the invitation,
+-- the walk-in record only takes them over once the email is confirmed
+ALTER TABLE IF EXISTS user_invitations
+ADD COLUMN claim_username VARCHAR(255),
+ADD COLUMN claim_first_name VARCHAR(255),
+ADD COLUMN claim_last_name VARCHAR(255),
+ADD COLUMN claim_password BYTEA,
+ADD COLUMN claim_role VARCHAR(255),
+ADD COLUMN claim_locale VARCHAR(8);
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS user_invitations
+DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,3 @@
+-- activation emails are resent at most once per cooldown, counted from the latest invitation
+ALTER TABLE IF EXISTS user_invitations
+ADD COLUMN created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
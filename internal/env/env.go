@@ -25,3 +25,15 @@ func GetInt(key string, fallback int) int {
 	}
 	return num
 }
+func GetBool(key string, fallback bool) bool {
+	result, err := os.LookupEnv(key)
+
+	if !err {
+		return fallback
+	}
+	value, convErr := strconv.ParseBool(result)
+	if convErr != nil {
+		return fallback
+	}
+	return value
+}
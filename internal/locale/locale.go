@@ -0,0 +1,111 @@
+package locale
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Bosnian = "bs"
+	English = "en"
+	German  = "de"
+
+	Default = Bosnian
+)
+
+var Supported = []string{Bosnian, English, German}
+
+func IsSupported(locale string) bool {
+	for _, supported := range Supported {
+		if supported == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// Negotiate picks the supported locale the Accept-Language header prefers the most,
+// "bs-BA" matches bs and the languages we treat as bs (hr, sr), anything unknown falls back to Default
+func Negotiate(acceptLanguage string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		switch language {
+		case "hr", "sr", "sh":
+			language = Bosnian
+		}
+		if IsSupported(language) {
+			candidates = append(candidates, candidate{locale: language, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return Default
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].locale
+}
+
+var monthNames = map[string][12]string{
+	Bosnian: {"januar", "februar", "mart", "april", "maj", "jun", "jul", "avgust", "septembar", "oktobar", "novembar", "decembar"},
+	English: {"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	German:  {"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+}
+
+var weekdayNames = map[string][7]string{
+	Bosnian: {"nedelja", "ponedeljak", "utorak", "sreda", "četvrtak", "petak", "subota"},
+	English: {"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	German:  {"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+}
+
+// FormatDate writes the date the way it's read in the locale, e.g. "ponedeljak, 2. mart 2026."
+func FormatDate(t time.Time, locale string) string {
+	if !IsSupported(locale) {
+		locale = Default
+	}
+	weekday := weekdayNames[locale][t.Weekday()]
+	month := monthNames[locale][t.Month()-1]
+
+	switch locale {
+	case English:
+		return fmt.Sprintf("%s, %s %d, %d", weekday, month, t.Day(), t.Year())
+	case German:
+		return fmt.Sprintf("%s, %d. %s %d", weekday, t.Day(), month, t.Year())
+	default:
+		return fmt.Sprintf("%s, %d. %s %d.", weekday, t.Day(), month, t.Year())
+	}
+}
+
+func FormatTime(t time.Time, locale string) string {
+	switch locale {
+	case English:
+		return t.Format("3:04 PM")
+	case German:
+		return t.Format("15:04") + " Uhr"
+	default:
+		return t.Format("15:04")
+	}
+}
@@ -0,0 +1,87 @@
+package locale
+
+// messages are the user facing API texts keyed by the stable error code they belong to,
+// a %s in a message is filled in by the caller
+var messages = map[string]map[string]string{
+	Bosnian: {
+		"internal_error":     "došlo je do greške na serveru",
+		"bad_request":        "zahtev nije ispravan",
+		"invalid_json":       "telo zahteva nije ispravan JSON",
+		"invalid_parameter":  "parametar nije ispravan broj",
+		"validation_failed":  "neka polja nisu ispravna",
+		"not_found":          "nije pronađeno",
+		"conflict":           "zapis već postoji",
+		"forbidden":          "nemate pristup",
+		"unauthorized":       "niste prijavljeni",
+		"rate_limited":       "previše zahteva, pokušajte ponovo za %s",
+		"account_locked":     "nalog je privremeno zaključan, pokušajte ponovo za %s",
+		"retry":              "izmena se preklopila sa drugom, pokušajte ponovo",
+		"duplicate_email":    "korisnik sa ovim emailom već postoji",
+		"duplicate_username": "korisnik sa ovim korisničkim imenom već postoji",
+		"slot_overlap":       "termin se preklapa sa postojećim",
+		"invalid_transition": "termin ne može preći u taj status",
+		"not_started":        "termin još nije počeo",
+		"too_late_to_change": "termin se više ne može menjati",
+		"expired":            "link je istekao",
+		"invalid_reference":  "povezani zapis ne postoji",
+		"invalid_value":      "vrednost nije dozvoljena",
+		"invalid_code":       "kod za potvrdu nije ispravan",
+		"phone_not_verified": "broj telefona nije potvrđen",
+	},
+	English: {
+		"internal_error":     "the server encountered a problem",
+		"bad_request":        "the request isn't valid",
+		"invalid_json":       "the body isn't valid JSON",
+		"invalid_parameter":  "a parameter isn't a valid number",
+		"validation_failed":  "some fields are invalid",
+		"not_found":          "not found",
+		"conflict":           "resource already exists",
+		"forbidden":          "forbidden",
+		"unauthorized":       "unauthorized",
+		"rate_limited":       "rate limit exceeded, retry after: %s",
+		"account_locked":     "account temporarily locked, retry after: %s",
+		"retry":              "the change collided with a concurrent one, try again",
+		"duplicate_email":    "a user with that email already exists",
+		"duplicate_username": "a user with that username already exists",
+		"slot_overlap":       "the slot overlaps an existing one",
+		"invalid_transition": "the appointment can't change to that status",
+		"not_started":        "the appointment hasn't started yet",
+		"too_late_to_change": "the appointment can no longer be changed",
+		"expired":            "the link has expired",
+		"invalid_reference":  "a referenced record doesn't exist",
+		"invalid_value":      "the value isn't allowed",
+		"invalid_code":       "the verification code is wrong",
+		"phone_not_verified": "the phone number isn't verified",
+	},
+	German: {
+		"internal_error":     "auf dem Server ist ein Fehler aufgetreten",
+		"bad_request":        "die Anfrage ist ungültig",
+		"invalid_json":       "der Inhalt ist kein gültiges JSON",
+		"invalid_parameter":  "ein Parameter ist keine gültige Zahl",
+		"validation_failed":  "einige Felder sind ungültig",
+		"not_found":          "nicht gefunden",
+		"conflict":           "der Eintrag existiert bereits",
+		"forbidden":          "kein Zugriff",
+		"unauthorized":       "nicht angemeldet",
+		"rate_limited":       "zu viele Anfragen, erneut versuchen in %s",
+		"account_locked":     "das Konto ist vorübergehend gesperrt, erneut versuchen in %s",
+		"retry":              "die Änderung kollidierte mit einer anderen, bitte erneut versuchen",
+		"duplicate_email":    "ein Benutzer mit dieser E-Mail existiert bereits",
+		"duplicate_username": "ein Benutzer mit diesem Benutzernamen existiert bereits",
+		"slot_overlap":       "der Termin überschneidet sich mit einem bestehenden",
+		"invalid_transition": "der Termin kann nicht in diesen Status wechseln",
+		"not_started":        "der Termin hat noch nicht begonnen",
+		"too_late_to_change": "der Termin kann nicht mehr geändert werden",
+		"expired":            "der Link ist abgelaufen",
+		"invalid_reference":  "ein verknüpfter Eintrag existiert nicht",
+		"invalid_value":      "der Wert ist nicht erlaubt",
+		"invalid_code":       "der Bestätigungscode ist falsch",
+		"phone_not_verified": "die Telefonnummer ist nicht bestätigt",
+	},
+}
+
+// Message returns the text for the key in the locale, ok is false when there is none
+func Message(locale, key string) (string, bool) {
+	message, ok := messages[locale][key]
+	return message, ok
+}
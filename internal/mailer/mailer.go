@@ -1,6 +1,14 @@
 package mailer
 
-import "embed"
+import (
+	"embed"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"text/template"
+
+	"github.com/MisterDodik/Barbershop/internal/locale"
+)
 
 const (
 	FromName            = "Barbershop"
@@ -8,9 +16,37 @@ const (
 	UserWelcomeTemplate = "user_invitation.tmpl"
 )
 
+// templates in the root folder are the Bosnian ones, translations live in a folder named after their locale
+//
 //go:embed "templates"
 var FS embed.FS
 
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandbox bool) (int, error)
+	Send(templateFile, locale, username, email string, data any, isSandbox bool) (int, error)
+}
+
+// parseTemplate loads the template in the recipient's language, falling back to the default one
+// when there is no translation. Templates format dates and times with the date and time functions.
+func parseTemplate(templateFile, lang string) (*template.Template, error) {
+	return template.New(templateFile).Funcs(templateFuncs(lang)).ParseFS(FS, templatePath(templateFile, lang))
+}
+
+// parseHTMLTemplate loads the same template as parseTemplate with html/template, the body is executed from it
+// so the values it's sent with are escaped
+func parseHTMLTemplate(templateFile, lang string) (*htmltemplate.Template, error) {
+	return htmltemplate.New(templateFile).Funcs(htmltemplate.FuncMap(templateFuncs(lang))).ParseFS(FS, templatePath(templateFile, lang))
+}
+
+func templatePath(templateFile, lang string) string {
+	if !locale.IsSupported(lang) {
+		lang = locale.Default
+	}
+
+	if lang != locale.Default {
+		translated := path.Join("templates", lang, templateFile)
+		if _, err := fs.Stat(FS, translated); err == nil {
+			return translated
+		}
+	}
+	return path.Join("templates", templateFile)
 }
@@ -1,11 +1,11 @@
 package mailer
 
 import (
-	"bytes"
 	"errors"
+	"log"
 	"net/http"
-	"text/template"
 
+	"github.com/MisterDodik/Barbershop/internal/locale"
 	gomail "gopkg.in/gomail.v2"
 )
 
@@ -16,9 +16,20 @@ type MailTrapMailer struct {
 	port      int
 	username  string
 	password  string
+	headers   Headers
+	overrides Overrides
 }
 
-func NewMailTrapMailer(apiKey, fromEmail, host, username, password string, port int) (*MailTrapMailer, error) {
+// Headers are added to every email, the empty ones are left out
+type Headers struct {
+	FromName       string //shown next to the from address, FromName when empty
+	ReplyTo        string
+	UnsubscribeURL string //offered in List-Unsubscribe next to a mailto: link to ReplyTo or the from address
+}
+
+// NewMailTrapMailer sends the templates saved in overrides instead of the embedded ones when there are any,
+// overrides may be nil
+func NewMailTrapMailer(apiKey, fromEmail, host, username, password string, port int, headers Headers, overrides Overrides) (*MailTrapMailer, error) {
 	if apiKey == "" || fromEmail == "" || host == "" || username == "" || password == "" {
 		return &MailTrapMailer{}, errors.New("some fields are missing")
 	}
@@ -30,45 +41,76 @@ func NewMailTrapMailer(apiKey, fromEmail, host, username, password string, port
 		port:      port,
 		username:  username,
 		password:  password,
+		headers:   headers,
+		overrides: overrides,
 	}, nil
 }
 
-func (m *MailTrapMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
-	//Template parsing
-
+func (m *MailTrapMailer) Send(templateFile, lang, username, email string, data any, isSandbox bool) (int, error) {
 	if !isSandbox {
 		return http.StatusAccepted, errors.New("isSandbox is set to false")
 	}
 
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
-	if err != nil {
-		return -1, err
+	if !locale.IsSupported(lang) {
+		lang = locale.Default
 	}
 
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return -1, err
-	}
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
+	rendered, err := Render(templateFile, lang, m.findOverride(templateFile, lang), data)
 	if err != nil {
 		return -1, err
 	}
 
-	message := gomail.NewMessage()
-	message.SetHeader("From", m.fromEmail)
-	message.SetHeader("To", email)
-	message.SetHeader("Subject", subject.String())
-
-	message.AddAlternative("text/html", body.String())
+	message := m.newMessage(username, email, rendered)
 
 	dialer := gomail.NewDialer(m.host, m.port, m.username, m.apiKey)
 
-	for i := 0; i < 3; i++ {
-		if err := dialer.DialAndSend(message); err == nil {
+	for i := 0; i < maxRetries; i++ {
+		if err = dialer.DialAndSend(message); err == nil {
 			return 200, nil
 		}
 	}
 	return -1, err
 }
+
+// newMessage builds a multipart/alternative message, the plain text part goes first
+// so clients that can show HTML prefer the last one
+func (m *MailTrapMailer) newMessage(username, email string, rendered *Email) *gomail.Message {
+	fromName := m.headers.FromName
+	if fromName == "" {
+		fromName = FromName
+	}
+	replyTo := m.headers.ReplyTo
+	if replyTo == "" {
+		replyTo = m.fromEmail
+	}
+
+	message := gomail.NewMessage()
+	message.SetAddressHeader("From", m.fromEmail, fromName)
+	message.SetAddressHeader("To", email, username)
+	message.SetHeader("Reply-To", replyTo)
+	message.SetHeader("Subject", rendered.Subject)
+
+	unsubscribe := "<mailto:" + replyTo + "?subject=unsubscribe>"
+	if m.headers.UnsubscribeURL != "" {
+		unsubscribe = "<" + m.headers.UnsubscribeURL + ">, " + unsubscribe
+	}
+	message.SetHeader("List-Unsubscribe", unsubscribe)
+
+	message.SetBody("text/plain", rendered.Text)
+	message.AddAlternative("text/html", rendered.HTML)
+	return message
+}
+
+// findOverride falls back to the embedded template when the saved one can't be read,
+// an email with the old wording is better than none
+func (m *MailTrapMailer) findOverride(templateFile, lang string) *Override {
+	if m.overrides == nil {
+		return nil
+	}
+	override, err := m.overrides.Find(templateFile, lang)
+	if err != nil {
+		log.Printf("couldn't load the %s override of %s, sending the embedded one: %s", lang, templateFile, err)
+		return nil
+	}
+	return override
+}
@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestNewMessage(t *testing.T) {
+	mailer := &MailTrapMailer{
+		fromEmail: "noreply@barbershop.example",
+		headers: Headers{
+			FromName:       "Downtown Barbershop",
+			ReplyTo:        "hello@barbershop.example",
+			UnsubscribeURL: "https://barbershop.example/unsubscribe",
+		},
+	}
+	rendered := &Email{
+		Subject: "Your appointment",
+		Text:    "See you on Monday\n",
+		HTML:    "<p>See you on <b>Monday</b></p>",
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err := mailer.newMessage("customer", "customer@example.com", rendered).WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	message, err := mail.ReadMessage(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := message.Header.AddressList("From")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(from) != 1 || from[0].Name != "Downtown Barbershop" || from[0].Address != "noreply@barbershop.example" {
+		t.Fatalf("From = %v", from)
+	}
+	if replyTo := message.Header.Get("Reply-To"); replyTo != "hello@barbershop.example" {
+		t.Fatalf("Reply-To = %q", replyTo)
+	}
+	wantUnsubscribe := "<https://barbershop.example/unsubscribe>, <mailto:hello@barbershop.example?subject=unsubscribe>"
+	if unsubscribe := message.Header.Get("List-Unsubscribe"); unsubscribe != wantUnsubscribe {
+		t.Fatalf("List-Unsubscribe = %q, want %q", unsubscribe, wantUnsubscribe)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", mediaType)
+	}
+
+	//clients show the last part they can, so the HTML has to come after the text
+	want := []struct{ contentType, body string }{
+		{"text/plain", rendered.Text},
+		{"text/html", rendered.HTML},
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for _, want := range want {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("reading the %s part: %s", want.contentType, err)
+		}
+		contentType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//quoted-printable sends the line breaks as CRLF
+		if contentType != want.contentType || strings.ReplaceAll(string(body), "\r\n", "\n") != want.body {
+			t.Fatalf("got %s part %q, want %s part %q", contentType, body, want.contentType, want.body)
+		}
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Fatalf("got %v after the HTML part, want no more parts", err)
+	}
+}
+
+func TestNewMessageDefaults(t *testing.T) {
+	mailer := &MailTrapMailer{fromEmail: "noreply@barbershop.example"}
+
+	buffer := new(bytes.Buffer)
+	if _, err := mailer.newMessage("customer", "customer@example.com", &Email{Subject: "Hi", Text: "Hi", HTML: "<p>Hi</p>"}).WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	message, err := mail.ReadMessage(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := message.Header.AddressList("From")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(from) != 1 || from[0].Name != FromName {
+		t.Fatalf("From = %v, want the name %q", from, FromName)
+	}
+	//replies and unsubscribe requests go to the from address when there's no reply-to
+	if replyTo := message.Header.Get("Reply-To"); replyTo != "noreply@barbershop.example" {
+		t.Fatalf("Reply-To = %q", replyTo)
+	}
+	if unsubscribe := message.Header.Get("List-Unsubscribe"); unsubscribe != "<mailto:noreply@barbershop.example?subject=unsubscribe>" {
+		t.Fatalf("List-Unsubscribe = %q", unsubscribe)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"paragraphs", "<p>Hello</p><p>World</p>", "Hello\n\nWorld\n"},
+		{"line break", "Line one<br>Line two", "Line one\nLine two\n"},
+		{"list", "<p>Services:</p><ul><li>Haircut</li><li>Shave</li></ul>", "Services:\n\n- Haircut\n- Shave\n"},
+		{"link", `<a href="https://barbershop.example/confirm">Confirm</a>`, "Confirm (https://barbershop.example/confirm)\n"},
+		{"link showing its address", `<a href="https://barbershop.example">https://barbershop.example</a>`, "https://barbershop.example\n"},
+		{"link without an address", `<a>Nowhere</a>`, "Nowhere\n"},
+		{"head, style and script", "<html><head><title>Title</title><style>p { color: red }</style></head><body><script>alert(1)</script><p>Body</p></body></html>", "Body\n"},
+		{"source whitespace", "<p>\n    Hello\n    there\n</p>", "Hello there\n"},
+		{"entities", "<p>Tom &amp; Jerry &lt;3</p>", "Tom & Jerry <3\n"},
+		{"empty", "", "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := htmlToText(test.html); got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/locale"
+)
+
+// Override is a subject and body edited in the admin that replaces the embedded template
+type Override struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Overrides finds the override saved for a template in a locale, a nil override means the embedded template is sent
+type Overrides interface {
+	Find(templateFile, locale string) (*Override, error)
+}
+
+// Templates lists the embedded templates that can be overridden
+func Templates() ([]string, error) {
+	entries, err := fs.ReadDir(FS, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tmpl") {
+			templates = append(templates, entry.Name())
+		}
+	}
+	return templates, nil
+}
+
+func IsTemplate(templateFile string) bool {
+	info, err := fs.Stat(FS, path.Join("templates", templateFile))
+	return err == nil && !info.IsDir()
+}
+
+func templateFuncs(lang string) template.FuncMap {
+	return template.FuncMap{
+		"date": func(t time.Time) string { return locale.FormatDate(t, lang) },
+		"time": func(t time.Time) string { return locale.FormatTime(t, lang) },
+	}
+}
+
+// parseOverride builds the subject and body templates out of the override's text
+func parseOverride(templateFile, lang string, override *Override) (*template.Template, error) {
+	tmpl := template.New(templateFile).Funcs(templateFuncs(lang))
+	if _, err := tmpl.New("subject").Parse(override.Subject); err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.New("body").Parse(override.Body); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// parseHTMLOverride builds the body of the override with html/template like parseHTMLTemplate
+func parseHTMLOverride(templateFile, lang string, override *Override) (*htmltemplate.Template, error) {
+	tmpl := htmltemplate.New(templateFile).Funcs(htmltemplate.FuncMap(templateFuncs(lang)))
+	if _, err := tmpl.New("body").Parse(override.Body); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Email is a rendered template, Text is the plain text alternative of HTML
+type Email struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// Render executes the override when there is one and the embedded template otherwise.
+// The HTML body escapes the values it's sent with, customers write some of them, like a cancellation reason.
+// The plain text part comes from the template's text block, or from the HTML when it has none.
+func Render(templateFile, lang string, override *Override, data any) (*Email, error) {
+	var (
+		tmpl     *template.Template
+		htmlTmpl *htmltemplate.Template
+		err      error
+	)
+	if override != nil {
+		tmpl, err = parseOverride(templateFile, lang, override)
+		if err == nil {
+			htmlTmpl, err = parseHTMLOverride(templateFile, lang, override)
+		}
+	} else {
+		tmpl, err = parseTemplate(templateFile, lang)
+		if err == nil {
+			htmlTmpl, err = parseHTMLTemplate(templateFile, lang)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+	body := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return nil, err
+	}
+
+	email := &Email{
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    body.String(),
+	}
+	if tmpl.Lookup("text") != nil {
+		text := new(bytes.Buffer)
+		if err := tmpl.ExecuteTemplate(text, "text", data); err != nil {
+			return nil, err
+		}
+		email.Text = text.String()
+	} else {
+		email.Text = htmlToText(email.HTML)
+	}
+	return email, nil
+}
+
+// Source returns the text of the embedded template, the starting point for an override
+func Source(templateFile, lang string) (*Override, error) {
+	tmpl, err := parseTemplate(templateFile, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &Override{}
+	if subject := tmpl.Lookup("subject"); subject != nil {
+		source.Subject = subject.Tree.Root.String()
+	}
+	if body := tmpl.Lookup("body"); body != nil {
+		source.Body = body.Tree.Root.String()
+	}
+	return source, nil
+}
+
+// Variables returns the fields the code passes to the template, read off the embedded template,
+// and which of them are times that go through date and time
+func Variables(templateFile string) (fields, timeFields map[string]bool, err error) {
+	tmpl, err := parseTemplate(templateFile, locale.Default)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields, timeFields = map[string]bool{}, map[string]bool{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			collectFields(t.Tree.Root, fields, timeFields)
+		}
+	}
+	return fields, timeFields, nil
+}
+
+// ValidateOverride checks that the override parses, uses only the variables the template is sent with
+// and renders with sample data
+func ValidateOverride(templateFile string, override *Override) error {
+	allowed, _, err := Variables(templateFile)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := parseOverride(templateFile, locale.Default, override)
+	if err != nil {
+		return err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		used, timeFields := map[string]bool{}, map[string]bool{}
+		collectFields(t.Tree.Root, used, timeFields)
+
+		var unknown []string
+		for field := range used {
+			if !allowed[field] {
+				unknown = append(unknown, "."+field)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return fmt.Errorf("%s uses %s, allowed variables are %s", t.Name(), strings.Join(unknown, ", "), allowedList(allowed))
+		}
+	}
+
+	data, err := SampleData(templateFile)
+	if err != nil {
+		return err
+	}
+	_, err = Render(templateFile, locale.Default, override, data)
+	return err
+}
+
+func allowedList(allowed map[string]bool) string {
+	var names []string
+	for field := range allowed {
+		names = append(names, "."+field)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// SampleData fills every variable of the template with a made up value for previews
+func SampleData(templateFile string) (map[string]any, error) {
+	fields, timeFields, err := Variables(templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	sampleTime := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 10, 30, 0, 0, tomorrow.Location())
+
+	data := map[string]any{}
+	for field := range fields {
+		switch {
+		case timeFields[field]:
+			data[field] = sampleTime
+		case strings.HasSuffix(field, "URL"):
+			data[field] = "https://example.com/" + strings.ToLower(strings.TrimSuffix(field, "URL"))
+		default:
+			data[field] = "[" + field + "]"
+		}
+	}
+	return data, nil
+}
+
+// collectFields records the top level fields a template reads, {{.StartTime.Year}} counts as StartTime,
+// a field passed to date or time is also recorded as a time
+func collectFields(node parse.Node, fields, timeFields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, fields, timeFields)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, fields, timeFields)
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, fields, timeFields)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, fields, timeFields)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, fields, timeFields)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, fields, timeFields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, fields, timeFields)
+		}
+	case *parse.CommandNode:
+		isTimeFunc := false
+		if len(n.Args) > 0 {
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok {
+				isTimeFunc = ident.Ident == "date" || ident.Ident == "time"
+			}
+		}
+		for _, arg := range n.Args {
+			if field, ok := arg.(*parse.FieldNode); ok && isTimeFunc {
+				timeFields[field.Ident[0]] = true
+			}
+			collectFields(arg, fields, timeFields)
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, fields, timeFields)
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	case *parse.VariableNode:
+		//$.Field reads the data passed to the template as well
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			fields[n.Ident[1]] = true
+		}
+	}
+}
+
+func collectBranch(n *parse.BranchNode, fields, timeFields map[string]bool) {
+	collectFields(n.Pipe, fields, timeFields)
+	collectFields(n.List, fields, timeFields)
+	collectFields(n.ElseList, fields, timeFields)
+}
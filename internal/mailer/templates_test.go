@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MisterDodik/Barbershop/internal/locale"
+)
+
+const injected = `<a href="https://phishing.example">log in</a>`
+
+func TestRenderEscapesValuesInHTML(t *testing.T) {
+	templates, err := Templates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, templateFile := range templates {
+		for _, lang := range locale.Supported {
+			data, err := SampleData(templateFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for field, value := range data {
+				if _, isText := value.(string); isText && !strings.HasSuffix(field, "URL") {
+					data[field] = injected
+				}
+			}
+			if _, found := data["BarbershopName"]; found {
+				data["BarbershopName"] = "Cut & Shave"
+			}
+
+			email, err := Render(templateFile, lang, nil, data)
+			if err != nil {
+				t.Fatalf("%s %s: %s", templateFile, lang, err)
+			}
+			if strings.Contains(email.HTML, injected) {
+				t.Errorf("%s %s: a value added markup to the HTML", templateFile, lang)
+			}
+			if strings.Contains(email.HTML, "ZgotmplZ") {
+				t.Errorf("%s %s: a link was dropped as unsafe", templateFile, lang)
+			}
+			//the subject and the text part are plain text and aren't escaped
+			if strings.Contains(email.Subject, "&amp;") || strings.Contains(email.Text, "&amp;") {
+				t.Errorf("%s %s: plain text was escaped", templateFile, lang)
+			}
+		}
+	}
+}
+
+func TestRenderEscapesValuesInOverrides(t *testing.T) {
+	override := &Override{
+		Subject: "Cancelled by {{.CustomerName}}",
+		Body:    `<p>{{.CustomerName}} cancelled: {{.Reason}}</p>`,
+	}
+	data := map[string]any{
+		"CustomerName": "Tom & Jerry",
+		"Reason":       injected,
+	}
+
+	email, err := Render("appointment_cancelled_by_customer.tmpl", "en", override, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(email.HTML, injected) {
+		t.Fatalf("the reason added markup to the HTML: %s", email.HTML)
+	}
+	if email.Subject != "Cancelled by Tom & Jerry" {
+		t.Fatalf("subject = %q", email.Subject)
+	}
+	if !strings.Contains(email.Text, injected) {
+		t.Fatalf("the text part should carry the reason as written: %q", email.Text)
+	}
+}
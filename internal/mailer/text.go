@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// line breaks in the HTML source are only whitespace, tidyText collapses it
+var sourceLineBreaks = strings.NewReplacer("\r", " ", "\n", " ", "\t", " ")
+
+// htmlToText derives the plain text part from the HTML body of templates without a text block,
+// paragraphs and list items stay on lines of their own and links keep their address
+func htmlToText(body string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	text := new(strings.Builder)
+
+	hidden := 0 //inside head, title, style or script
+	href, linkStart := "", 0
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return tidyText(text.String())
+		case html.TextToken:
+			if hidden == 0 {
+				text.WriteString(sourceLineBreaks.Replace(string(tokenizer.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := tokenizer.TagName()
+			tag := atom.Lookup(name)
+			isStart := tokenType != html.EndTagToken
+
+			switch tag {
+			case atom.Head, atom.Title, atom.Style, atom.Script:
+				if tokenType == html.StartTagToken {
+					hidden++
+				} else if tokenType == html.EndTagToken && hidden > 0 {
+					hidden--
+				}
+			case atom.Br:
+				text.WriteString("\n")
+			case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Ul, atom.Ol, atom.Table, atom.Tr:
+				text.WriteString("\n\n")
+			case atom.Li:
+				if isStart {
+					text.WriteString("\n- ")
+				}
+			case atom.A:
+				if isStart {
+					href, linkStart = "", text.Len()
+					for hasAttr {
+						var key, value []byte
+						key, value, hasAttr = tokenizer.TagAttr()
+						if string(key) == "href" {
+							href = string(value)
+						}
+					}
+					continue
+				}
+				//a link whose text is the address itself is written once
+				if href != "" && strings.TrimSpace(text.String()[linkStart:]) != href {
+					text.WriteString(" (" + href + ")")
+				}
+				href = ""
+			}
+		}
+	}
+}
+
+// tidyText collapses the whitespace within every line and leaves at most one empty line between paragraphs
+func tidyText(text string) string {
+	var lines []string
+	empty := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !empty {
+				lines = append(lines, "")
+			}
+			empty = true
+			continue
+		}
+		lines = append(lines, line)
+		empty = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
@@ -0,0 +1,137 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/MisterDodik/Barbershop/internal/locale"
+	"github.com/MisterDodik/Barbershop/internal/mailer"
+)
+
+// channels a user can pick to be notified on
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelBoth  = "both"
+)
+
+var Channels = []string{ChannelEmail, ChannelSMS, ChannelBoth}
+
+var ErrUnreachable = errors.New("the recipient has neither an email nor a verified phone")
+
+// texts are named after the email template they stand in for, the Bosnian ones are in the root folder
+// and translations in a folder named after their locale, like the email templates
+//
+//go:embed "templates"
+var FS embed.FS
+
+// Recipient is who a notification goes to, Phone is only set when it's verified
+type Recipient struct {
+	Name    string
+	Email   string
+	Phone   string
+	Locale  string
+	Channel string
+}
+
+type Client interface {
+	// Notify sends the template on the channels the recipient picked, falling back to the one
+	// they can be reached on. Only some templates have a text, the rest always go by email.
+	Notify(ctx context.Context, templateFile string, recipient Recipient, data any, isSandbox bool) error
+	// Text sends the template's text to the phone whatever the channel preferences, for verification codes
+	Text(ctx context.Context, templateFile, lang, phone string, data any) error
+}
+
+type Notifier struct {
+	mailer mailer.Client
+	sms    SMSProvider
+}
+
+func New(mailer mailer.Client, sms SMSProvider) *Notifier {
+	return &Notifier{
+		mailer: mailer,
+		sms:    sms,
+	}
+}
+
+func (n *Notifier) Notify(ctx context.Context, templateFile string, recipient Recipient, data any, isSandbox bool) error {
+	hasText := HasText(templateFile)
+
+	byEmail := recipient.Email != "" && (recipient.Channel != ChannelSMS || !hasText)
+	bySMS := recipient.Phone != "" && hasText && recipient.Channel != ChannelEmail
+	if !byEmail && !bySMS {
+		//the picked channel isn't available, e.g. a walk-in left only a phone
+		byEmail = recipient.Email != ""
+		bySMS = !byEmail && recipient.Phone != "" && hasText
+	}
+	if !byEmail && !bySMS {
+		return ErrUnreachable
+	}
+
+	var errs []error
+	if byEmail {
+		statusCode, err := n.mailer.Send(templateFile, recipient.Locale, recipient.Name, recipient.Email, data, isSandbox)
+		if err != nil && statusCode != http.StatusAccepted {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	if bySMS {
+		if err := n.Text(ctx, templateFile, recipient.Locale, recipient.Phone, data); err != nil {
+			errs = append(errs, fmt.Errorf("sms: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) Text(ctx context.Context, templateFile, lang, phone string, data any) error {
+	text, err := RenderText(templateFile, lang, data)
+	if err != nil {
+		return err
+	}
+	return n.sms.Send(ctx, phone, text)
+}
+
+// HasText reports whether the template can be sent by SMS
+func HasText(templateFile string) bool {
+	_, err := fs.Stat(FS, path.Join("templates", templateFile))
+	return err == nil
+}
+
+// RenderText executes the text in the recipient's language, falling back to the default one when there is no translation
+func RenderText(templateFile, lang string, data any) (string, error) {
+	if !locale.IsSupported(lang) {
+		lang = locale.Default
+	}
+
+	templatePath := path.Join("templates", templateFile)
+	if lang != locale.Default {
+		translated := path.Join("templates", lang, templateFile)
+		if _, err := fs.Stat(FS, translated); err == nil {
+			templatePath = translated
+		}
+	}
+
+	funcs := template.FuncMap{
+		"date": func(t time.Time) string { return locale.FormatDate(t, lang) },
+		"time": func(t time.Time) string { return locale.FormatTime(t, lang) },
+	}
+	tmpl, err := template.New(path.Base(templatePath)).Funcs(funcs).ParseFS(FS, templatePath)
+	if err != nil {
+		return "", err
+	}
+
+	text := new(bytes.Buffer)
+	if err := tmpl.Execute(text, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text.String()), nil
+}
@@ -0,0 +1,84 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SMSProvider interface {
+	Send(ctx context.Context, to, text string) error
+}
+
+// HTTPProvider sends texts through a Twilio compatible messages API,
+// the form fields To, From and Body are posted with basic auth
+type HTTPProvider struct {
+	endpoint   string
+	accountID  string
+	authToken  string
+	from       string
+	httpClient *http.Client
+}
+
+func NewHTTPProvider(endpoint, accountID, authToken, from string, httpClient *http.Client) *HTTPProvider {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: time.Second * 10}
+	}
+	return &HTTPProvider{
+		endpoint:   endpoint,
+		accountID:  accountID,
+		authToken:  authToken,
+		from:       from,
+		httpClient: httpClient,
+	}
+}
+
+func (p *HTTPProvider) Send(ctx context.Context, to, text string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", p.from)
+	form.Set("Body", text)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(p.accountID, p.authToken)
+
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("sms provider returned status %d: %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+// LogProvider writes the texts out instead of sending them, a stand-in for development
+type LogProvider struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogProvider(w io.Writer) *LogProvider {
+	return &LogProvider{w: w}
+}
+
+func (p *LogProvider) Send(ctx context.Context, to, text string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := fmt.Fprintf(p.w, "%s sms to %s: %s\n", time.Now().Format(time.RFC3339), to, text)
+	return err
+}
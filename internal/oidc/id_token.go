@@ -0,0 +1,88 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type IDTokenClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"` //google sends a bool, apple sends "true"/"false"
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	if _, err := p.Discover(ctx); err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	},
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", Error_InvalidIDToken, err.Error())
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, Error_NonceMismatch
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", Error_InvalidIDToken)
+	}
+
+	return &IDTokenClaims{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: parseEmailVerified(claims.EmailVerified),
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
+
+func parseEmailVerified(v any) bool {
+	switch value := v.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
+
+// Registry holds the configured providers by name, e.g. "google" or "apple"
+type Registry map[string]*Provider
+
+func (r Registry) Get(name string) (*Provider, error) {
+	provider, ok := r[name]
+	if !ok {
+		return nil, Error_UnknownProvider
+	}
+	return provider, nil
+}
+
+func IsVerificationError(err error) bool {
+	return errors.Is(err, Error_InvalidIDToken) || errors.Is(err, Error_NonceMismatch)
+}
@@ -0,0 +1,285 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testProvider is a stand-in OpenID Connect provider serving discovery, token and JWKS.
+// authorize plays the part of the user logging in at the provider.
+type testProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu            sync.Mutex
+	codes         map[string]authorization
+	emailVerified any
+}
+
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{
+		t:             t,
+		key:           key,
+		codes:         map[string]authorization{},
+		emailVerified: true,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) config() Config {
+	return Config{
+		Name:         "test",
+		Issuer:       p.server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:3000/oauth/callback/test",
+	}
+}
+
+// authorize reads the login url like the provider would and hands out a code for it
+func (p *testProvider) authorize(authCodeURL string) (code, state string) {
+	parsed, err := url.Parse(authCodeURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		p.t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+
+	code, err = RandomString()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	switch {
+	case !ok:
+		http.Error(w, "invalid_grant", http.StatusBadRequest)
+		return
+	case CodeChallenge(r.PostForm.Get("code_verifier")) != auth.codeChallenge:
+		http.Error(w, "invalid_grant: code verifier", http.StatusBadRequest)
+		return
+	case r.PostForm.Get("redirect_uri") != auth.redirectURI || r.PostForm.Get("client_id") != auth.clientID:
+		http.Error(w, "invalid_client", http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(TokenResponse{
+		AccessToken: "access-token",
+		TokenType:   "Bearer",
+		IDToken:     p.idToken(p.key, auth.clientID, auth.nonce),
+		ExpiresIn:   3600,
+	})
+}
+
+func (p *testProvider) idToken(key *rsa.PrivateKey, audience, nonce string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            audience,
+		"sub":            "subject-1",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "Customer@Example.com",
+		"email_verified": p.emailVerified,
+		"given_name":     "Test",
+		"family_name":    "Customer",
+	})
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return signed
+}
+
+// login runs the flow the api does: state, nonce and verifier are generated, the user is sent to the provider
+// and the code that comes back is exchanged with the verifier
+func login(t *testing.T, testProvider *testProvider, provider *Provider) (token *TokenResponse, nonce string, err error) {
+	ctx := context.Background()
+
+	state, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authCodeURL, err := provider.AuthCodeURL(ctx, state, nonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, returnedState := testProvider.authorize(authCodeURL)
+	if returnedState != state {
+		t.Fatalf("state = %q, want %q", returnedState, state)
+	}
+
+	token, err = provider.Exchange(ctx, code, verifier)
+	return token, nonce, err
+}
+
+func TestLoginRoundTrip(t *testing.T) {
+	testProvider := newTestProvider(t)
+	provider := NewProvider(testProvider.config(), testProvider.server.Client())
+
+	token, nonce, err := login(t, testProvider, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := provider.VerifyIDToken(context.Background(), token.IDToken, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "customer@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if claims.GivenName != "Test" || claims.FamilyName != "Customer" {
+		t.Fatalf("unexpected names %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	testProvider := newTestProvider(t)
+	provider := NewProvider(testProvider.config(), testProvider.server.Client())
+	ctx := context.Background()
+
+	authCodeURL, err := provider.AuthCodeURL(ctx, "state", "nonce", CodeChallenge("the-real-verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := testProvider.authorize(authCodeURL)
+
+	if _, err := provider.Exchange(ctx, code, "an-intercepted-code-without-verifier"); err == nil {
+		t.Fatal("the code was exchanged without the matching verifier")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	testProvider := newTestProvider(t)
+	provider := NewProvider(testProvider.config(), testProvider.server.Client())
+	ctx := context.Background()
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		token, _, err := login(t, testProvider, provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.VerifyIDToken(ctx, token.IDToken, "another-nonce"); !errors.Is(err, Error_NonceMismatch) {
+			t.Fatalf("got %v, want %v", err, Error_NonceMismatch)
+		}
+	})
+
+	t.Run("unknown signing key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged := testProvider.idToken(otherKey, "client-id", "nonce")
+		if _, err := provider.VerifyIDToken(ctx, forged, "nonce"); !IsVerificationError(err) {
+			t.Fatalf("got %v, want a verification error", err)
+		}
+	})
+
+	t.Run("token for another client", func(t *testing.T) {
+		other := testProvider.idToken(testProvider.key, "another-client", "nonce")
+		if _, err := provider.VerifyIDToken(ctx, other, "nonce"); !IsVerificationError(err) {
+			t.Fatalf("got %v, want a verification error", err)
+		}
+	})
+
+	t.Run("email verified as a string", func(t *testing.T) {
+		//apple sends "true"/"false"
+		for value, want := range map[string]bool{"true": true, "false": false} {
+			testProvider.emailVerified = value
+			token, nonce, err := login(t, testProvider, provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := provider.VerifyIDToken(ctx, token.IDToken, nonce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.EmailVerified != want {
+				t.Fatalf("email_verified %q read as %t", value, claims.EmailVerified)
+			}
+		}
+		testProvider.emailVerified = true
+	})
+}
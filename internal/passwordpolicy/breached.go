@@ -0,0 +1,80 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+const prefixLength = 5
+
+//go:embed breached_passwords.txt
+var bundledBreachedList string
+
+// BreachedList holds sha1 hashes of known breached passwords grouped by their first five hex
+// characters, the same k-anonymity layout haveibeenpwned uses, so a lookup only ever looks at
+// the suffixes sharing the candidate's prefix. Lines are "HASH" or "HASH:COUNT".
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+}
+
+func LoadBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{
+		ranges: make(map[string]map[string]struct{}),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+
+		prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+		if list.ranges[prefix] == nil {
+			list.ranges[prefix] = make(map[string]struct{})
+		}
+		list.ranges[prefix][suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// LoadBreachedListFile loads the list from path, or the bundled list when path is empty
+func LoadBreachedListFile(path string) (*BreachedList, error) {
+	if path == "" {
+		return LoadBreachedList(strings.NewReader(bundledBreachedList))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadBreachedList(f)
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+
+	suffixes, ok := l.ranges[hexHash[:prefixLength]]
+	if !ok {
+		return false
+	}
+	_, ok = suffixes[hexHash[prefixLength:]]
+	return ok
+}
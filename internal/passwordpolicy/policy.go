@@ -0,0 +1,96 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type Policy struct {
+	MinLength            int
+	RequireUpper         bool
+	RequireLower         bool
+	RequireDigit         bool
+	RequireSymbol        bool
+	DisallowPersonalInfo bool
+	Breached             *BreachedList
+}
+
+// ViolationError lists every rule the password broke so the user can fix them all at once
+type ViolationError struct {
+	Violations []string
+}
+
+func (e *ViolationError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+// Validate checks the password against the policy, personalInfo holds values like the
+// username and email that must not appear in the password
+func (p *Policy) Validate(password string, personalInfo ...string) error {
+	var violations []string
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, "must not contain your name, username or email")
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, "appears in a list of breached passwords")
+	}
+
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+func containsPersonalInfo(password string, personalInfo []string) bool {
+	lowerPassword := strings.ToLower(password)
+
+	for _, info := range personalInfo {
+		info = strings.ToLower(strings.TrimSpace(info))
+		candidates := []string{info}
+		//for emails the local part alone is the more likely thing to end up in a password
+		if localPart, _, found := strings.Cut(info, "@"); found {
+			candidates = append(candidates, localPart)
+		}
+
+		for _, candidate := range candidates {
+			//very short values would match by accident
+			if len(candidate) >= 3 && strings.Contains(lowerPassword, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
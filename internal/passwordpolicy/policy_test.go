@@ -0,0 +1,120 @@
+package passwordpolicy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+
+	breached, err := LoadBreachedListFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Policy{
+		MinLength:            10,
+		RequireUpper:         true,
+		RequireLower:         true,
+		RequireDigit:         true,
+		RequireSymbol:        true,
+		DisallowPersonalInfo: true,
+		Breached:             breached,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	policy := testPolicy(t)
+	personalInfo := []string{"marko_barber", "marko.petrovic@example.com", "Marko", "Petrovic"}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"strong", "Trim-and-fade-42", nil},
+		{"too short", "Fade-42", []string{"must be at least 10 characters long"}},
+		{"length counts characters, not bytes", "Šišanje-čćž-1", nil},
+		{"no uppercase", "trim-and-fade-42", []string{"must contain an uppercase letter"}},
+		{"no lowercase", "TRIM-AND-FADE-42", []string{"must contain a lowercase letter"}},
+		{"no digit", "Trim-and-fade-xx", []string{"must contain a digit"}},
+		{"no symbol", "TrimAndFade42x", []string{"must contain a symbol"}},
+		{"every rule at once", "fade", []string{
+			"must be at least 10 characters long",
+			"must contain an uppercase letter",
+			"must contain a digit",
+			"must contain a symbol",
+		}},
+		{"username", "Marko_Barber-2024", []string{"must not contain your name, username or email"}},
+		{"email", "x-Marko.Petrovic@example.com-1", []string{"must not contain your name, username or email"}},
+		{"local part of the email", "Marko.Petrovic#2024", []string{"must not contain your name, username or email"}},
+		{"first name", "Trim-marko-42x", []string{"must not contain your name, username or email"}},
+		{"last name", "PETROVIC-fade-42", []string{"must not contain your name, username or email"}},
+		{"breached", "Password1", []string{
+			"must be at least 10 characters long",
+			"must contain a symbol",
+			"appears in a list of breached passwords",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Validate(test.password, personalInfo...)
+			if test.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want no violations", err)
+				}
+				return
+			}
+
+			var violationErr *ViolationError
+			if !errors.As(err, &violationErr) {
+				t.Fatalf("got %v, want a ViolationError", err)
+			}
+			if !slices.Equal(violationErr.Violations, test.want) {
+				t.Fatalf("got %q, want %q", violationErr.Violations, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateShortPersonalInfo(t *testing.T) {
+	policy := testPolicy(t)
+
+	//values under three characters would match almost any password
+	if err := policy.Validate("Trim-and-fade-42", "Al", "", "an@example.com"); err != nil {
+		t.Fatalf("got %v, want no violations", err)
+	}
+}
+
+func TestValidateRulesOff(t *testing.T) {
+	policy := &Policy{MinLength: 4}
+
+	if err := policy.Validate("password", "password"); err != nil {
+		t.Fatalf("got %v, want no violations with the rules off", err)
+	}
+}
+
+func TestBreachedList(t *testing.T) {
+	list, err := LoadBreachedList(strings.NewReader(`
+# sha1 of "password" with a count, of "letmein" without one, in lowercase
+5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493
+b7a875fc1ea228b9061041b7cec4bd3c52ab3ce3
+not a hash
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for password, want := range map[string]bool{
+		"password": true,
+		"letmein":  true,
+		"Password": false,
+		"":         false,
+	} {
+		if got := list.Contains(password); got != want {
+			t.Errorf("Contains(%q) = %t, want %t", password, got, want)
+		}
+	}
+}
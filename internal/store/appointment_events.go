@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	StatusAvailable           = "available"
+	StatusPending             = "pending" //held for a guest until the booking is confirmed
+	StatusBooked              = "booked"
+	StatusInProgress          = "in_progress"
+	StatusCompleted           = "completed"
+	StatusMissed              = "missed"
+	StatusCancelledByCustomer = "cancelled_by_customer"
+	StatusCancelledByShop     = "cancelled_by_shop"
+	StatusExpired             = "expired" //a guest never confirmed the pending booking
+)
+
+var (
+	Error_InvalidTransition = errors.New("the appointment can't change to that status")
+	Error_NotStarted        = errors.New("the appointment hasn't started yet")
+)
+
+// allowedTransitions lists the statuses an appointment can move to from each status,
+// available stands for the free slot before the appointment exists.
+// Cancelled and expired appointments free their slot.
+var allowedTransitions = map[string][]string{
+	StatusAvailable:  {StatusPending, StatusBooked},
+	StatusPending:    {StatusBooked, StatusExpired},
+	StatusBooked:     {StatusInProgress, StatusCompleted, StatusMissed, StatusCancelledByCustomer, StatusCancelledByShop},
+	StatusInProgress: {StatusCompleted},
+}
+
+func CanTransition(from, to string) bool {
+	for _, status := range allowedTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+func freesSlot(status string) bool {
+	return status == StatusCancelledByCustomer || status == StatusCancelledByShop || status == StatusExpired
+}
+
+type AppointmentEvent struct {
+	ID            int64     `json:"id"`
+	AppointmentID int64     `json:"appointment_id"`
+	SlotID        *int64    `json:"slot_id"`
+	CustomerID    *int64    `json:"customer_id"`
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+	ActorID       *int64    `json:"actor_id"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func recordEvent(ctx context.Context, tx *sql.Tx, event *AppointmentEvent) error {
+	query := `
+		INSERT INTO appointment_events (appointment_id, slot_id, customer_id, from_status, to_status, actor_id, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		event.AppointmentID,
+		event.SlotID,
+		event.CustomerID,
+		event.FromStatus,
+		event.ToStatus,
+		event.ActorID,
+		event.Reason,
+	).Scan(
+		&event.ID,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return enqueueAppointmentWebhook(ctx, tx, event)
+}
+
+// StatusChange asks to move the active appointment in a slot to another status.
+// CustomerID is set when a customer changes their own appointment, WorkerID when a worker
+// may only change appointments in their own slots.
+type StatusChange struct {
+	SlotID             int64
+	To                 string
+	ActorID            *int64
+	CustomerID         *int64
+	WorkerID           *int64
+	Reason             string
+	CancellationWindow string
+}
+
+// Transition moves the appointment along the state machine and records the event.
+// The returned slot carries the customer it was booked by.
+func (s *TimeSlotsStorage) Transition(ctx context.Context, change StatusChange) (*BookedSlot, error) {
+	var slot BookedSlot
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, slot_id, status, start_time, worker_id, customer_id,
+				start_time <= NOW(), NOW() + $2::INTERVAL < start_time
+			FROM appointments
+			WHERE slot_id = $1 AND status NOT IN ` + inactiveStatuses + `
+			FOR UPDATE
+		`
+		window := change.CancellationWindow
+		if window == "" {
+			window = "0"
+		}
+		var (
+			status              string
+			started, changeable bool
+		)
+		err := tx.QueryRowContext(ctx, query, change.SlotID, window).Scan(
+			&slot.AppointmentID,
+			&slot.ID,
+			&status,
+			&slot.StartTime,
+			&slot.WorkerID,
+			&slot.CustomerID,
+			&started,
+			&changeable,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+
+		if change.CustomerID != nil && (slot.CustomerID == nil || *slot.CustomerID != *change.CustomerID) {
+			return Error_NotFound
+		}
+		if change.WorkerID != nil && slot.WorkerID != *change.WorkerID {
+			return Error_NotFound
+		}
+
+		if !CanTransition(status, change.To) {
+			return Error_InvalidTransition
+		}
+		switch change.To {
+		case StatusCompleted, StatusMissed:
+			if !started {
+				return Error_NotStarted
+			}
+		case StatusCancelledByCustomer:
+			if !changeable {
+				return Error_TooLateToChange
+			}
+		}
+
+		if freesSlot(change.To) {
+			if err := endAppointment(ctx, tx, slot.AppointmentID, change.To); err != nil {
+				return err
+			}
+		} else {
+			query = `
+				UPDATE appointments SET status = $2, updated_at = NOW() WHERE id = $1
+			`
+			if _, err := tx.ExecContext(ctx, query, slot.AppointmentID, change.To); err != nil {
+				return err
+			}
+		}
+
+		return recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: slot.AppointmentID,
+			SlotID:        &slot.ID,
+			CustomerID:    slot.CustomerID,
+			FromStatus:    status,
+			ToStatus:      change.To,
+			ActorID:       change.ActorID,
+			Reason:        change.Reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// ListEvents returns the history of an appointment, a non nil workerID limits it to that worker's appointments
+func (s *TimeSlotsStorage) ListEvents(ctx context.Context, appointmentID int64, workerID *int64) ([]AppointmentEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT worker_id FROM appointments WHERE id = $1
+	`
+	var appointmentWorkerID int64
+	if err := s.db.QueryRowContext(ctx, query, appointmentID).Scan(&appointmentWorkerID); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	if workerID != nil && appointmentWorkerID != *workerID {
+		return nil, Error_NotFound
+	}
+
+	query = `
+		SELECT id, appointment_id, slot_id, customer_id, from_status, to_status, actor_id, reason, created_at
+		FROM appointment_events
+		WHERE appointment_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, appointmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AppointmentEvent{}
+	for rows.Next() {
+		var event AppointmentEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.AppointmentID,
+			&event.SlotID,
+			&event.CustomerID,
+			&event.FromStatus,
+			&event.ToStatus,
+			&event.ActorID,
+			&event.Reason,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Appointment is a booking of a slot, it outlives the slot and stays after a cancellation
+type Appointment struct {
+	ID              int64     `json:"id"`
+	SlotID          *int64    `json:"slot_id"`
+	StartTime       time.Time `json:"start_time"`
+	Duration        string    `json:"duration"`
+	Service         string    `json:"service"`
+	Status          string    `json:"status"`
+	Customer        *User     `json:"customer,omitempty"`
+	WorkerID        int64     `json:"worker_id"`
+	WorkerFirstName string    `json:"worker_first_name"`
+}
+
+// BookedSlot is what a booking or status change returns about the appointment
+type BookedSlot struct {
+	ID            int64
+	AppointmentID int64
+	StartTime     time.Time
+	WorkerID      int64
+	CustomerID    *int64
+}
+
+// statuses of appointments that no longer hold their slot
+const inactiveStatuses = `('cancelled_by_customer', 'cancelled_by_shop', 'expired')`
+
+type newAppointment struct {
+	SlotID        int64
+	WorkerID      *int64 //limits the booking to that worker's slots
+	CustomerID    *int64
+	Status        string
+	Service       string
+	HoldExpiresAt *time.Time
+}
+
+// bookSlot takes a free slot and creates the appointment for it
+func bookSlot(ctx context.Context, tx *sql.Tx, appointment newAppointment) (*BookedSlot, error) {
+	query := `
+		UPDATE time_slots
+		SET is_booked = TRUE
+		WHERE id = $1 AND is_booked = FALSE`
+	args := []interface{}{appointment.SlotID}
+
+	if appointment.WorkerID != nil {
+		query += ` AND worker_id = $2`
+		args = append(args, *appointment.WorkerID)
+	}
+	query += `
+		RETURNING id, worker_id, start_time, duration
+	`
+
+	var (
+		slot     BookedSlot
+		duration string
+	)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(
+		&slot.ID,
+		&slot.WorkerID,
+		&slot.StartTime,
+		&duration,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		INSERT INTO appointments (slot_id, worker_id, customer_id, start_time, duration, status, service, hold_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		slot.ID,
+		slot.WorkerID,
+		appointment.CustomerID,
+		slot.StartTime,
+		duration,
+		appointment.Status,
+		appointment.Service,
+		appointment.HoldExpiresAt,
+	).Scan(
+		&slot.AppointmentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	slot.CustomerID = appointment.CustomerID
+	return &slot, nil
+}
+
+// endAppointment moves the appointment to a status that gives up its slot and frees the slot
+func endAppointment(ctx context.Context, tx *sql.Tx, appointmentID int64, status string) error {
+	query := `
+		UPDATE appointments
+		SET status = $2, manage_token = NULL, hold_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING slot_id
+	`
+	var slotID sql.NullInt64
+	if err := tx.QueryRowContext(ctx, query, appointmentID, status).Scan(&slotID); err != nil {
+		return err
+	}
+	if !slotID.Valid {
+		return nil
+	}
+
+	query = `
+		UPDATE time_slots SET is_booked = FALSE WHERE id = $1
+	`
+	_, err := tx.ExecContext(ctx, query, slotID.Int64)
+	return err
+}
@@ -0,0 +1,377 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type CustomerNotes struct {
+	CustomerID     int64     `json:"customer_id"`
+	Notes          string    `json:"notes"`
+	Allergies      string    `json:"allergies"`
+	PreferredStyle string    `json:"preferred_style"`
+	UpdatedBy      *int64    `json:"updated_by"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type CustomerVisit struct {
+	AppointmentID   int64  `json:"appointment_id"`
+	StartTime       string `json:"start_time"`
+	Status          string `json:"status"`
+	WorkerID        int64  `json:"worker_id"`
+	WorkerFirstName string `json:"worker_first_name"`
+}
+
+type CustomerHistory struct {
+	Customer    *User           `json:"customer"`
+	Visits      []CustomerVisit `json:"visits"`
+	VisitCount  int             `json:"visit_count"`
+	NoShowCount int             `json:"no_show_count"`
+	LastVisit   *string         `json:"last_visit"`
+	Notes       *CustomerNotes  `json:"notes"`
+}
+
+type CustomerStorage struct {
+	db *sql.DB
+}
+
+// Get returns a customer including walk-ins and accounts that aren't activated yet
+func (s *CustomerStorage) Get(ctx context.Context, customerID int64) (*User, error) {
+	return s.getBy(ctx, "id = $1", customerID)
+}
+
+func (s *CustomerStorage) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.getBy(ctx, "email = $1", email)
+}
+
+func (s *CustomerStorage) getBy(ctx context.Context, condition string, arg any) (*User, error) {
+	query := `
+		SELECT id, first_name, last_name, username, COALESCE(email, ''), phone, is_walk_in, is_active, locale, phone_verified_at, notification_channel, created_at
+		FROM users
+		WHERE roles = 'customer' AND deleted_at IS NULL AND ` + condition
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	customer := &User{Role: RoleCustomer}
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(
+		&customer.ID,
+		&customer.FirstName,
+		&customer.LastName,
+		&customer.Username,
+		&customer.Email,
+		&customer.Phone,
+		&customer.IsWalkIn,
+		&customer.IsActive,
+		&customer.Locale,
+		&customer.PhoneVerifiedAt,
+		&customer.NotificationChannel,
+		&customer.Created_at,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return customer, nil
+}
+
+// GetHistory returns the past completed and missed appointments of a customer across all workers
+func (s *CustomerStorage) GetHistory(ctx context.Context, customerID int64) (*CustomerHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT id, first_name, last_name, username, COALESCE(email, ''), phone, is_walk_in, created_at
+		FROM users
+		WHERE id = $1 AND roles = 'customer'
+	`
+	customer := &User{Role: RoleCustomer}
+	err := s.db.QueryRowContext(ctx, query, customerID).Scan(
+		&customer.ID,
+		&customer.FirstName,
+		&customer.LastName,
+		&customer.Username,
+		&customer.Email,
+		&customer.Phone,
+		&customer.IsWalkIn,
+		&customer.Created_at,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+
+	history := &CustomerHistory{
+		Customer: customer,
+		Visits:   []CustomerVisit{},
+	}
+
+	query = `
+		SELECT a.id, a.start_time, a.status, w.id, w.first_name
+		FROM appointments a
+		JOIN users w ON w.id = a.worker_id
+		WHERE a.customer_id = $1 AND a.status IN ('completed', 'missed') AND a.start_time < NOW()
+		ORDER BY a.start_time DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var visit CustomerVisit
+		if err := rows.Scan(
+			&visit.AppointmentID,
+			&visit.StartTime,
+			&visit.Status,
+			&visit.WorkerID,
+			&visit.WorkerFirstName,
+		); err != nil {
+			return nil, err
+		}
+
+		switch visit.Status {
+		case "completed":
+			history.VisitCount++
+			if history.LastVisit == nil {
+				history.LastVisit = &visit.StartTime
+			}
+		case "missed":
+			history.NoShowCount++
+		}
+		history.Visits = append(history.Visits, visit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	notes, err := s.GetNotes(ctx, customerID)
+	switch err {
+	case nil:
+		history.Notes = notes
+	case Error_NotFound:
+	default:
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (s *CustomerStorage) GetNotes(ctx context.Context, customerID int64) (*CustomerNotes, error) {
+	query := `
+		SELECT customer_id, notes, allergies, preferred_style, updated_by, updated_at
+		FROM customer_notes
+		WHERE customer_id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var notes CustomerNotes
+	err := s.db.QueryRowContext(ctx, query, customerID).Scan(
+		&notes.CustomerID,
+		&notes.Notes,
+		&notes.Allergies,
+		&notes.PreferredStyle,
+		&notes.UpdatedBy,
+		&notes.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return &notes, nil
+}
+
+func (s *CustomerStorage) UpsertNotes(ctx context.Context, notes *CustomerNotes) error {
+	query := `
+		INSERT INTO customer_notes (customer_id, notes, allergies, preferred_style, updated_by, updated_at)
+		SELECT $1, $2, $3, $4, $5, NOW()
+		WHERE EXISTS (SELECT 1 FROM users WHERE id = $1 AND roles = 'customer')
+		ON CONFLICT (customer_id) DO UPDATE SET
+			notes = EXCLUDED.notes,
+			allergies = EXCLUDED.allergies,
+			preferred_style = EXCLUDED.preferred_style,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		notes.CustomerID,
+		notes.Notes,
+		notes.Allergies,
+		notes.PreferredStyle,
+		notes.UpdatedBy,
+	).Scan(
+		&notes.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return Error_NotFound
+		default:
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+type CustomerQuery struct {
+	Search string
+	Sort   string
+	Order  string
+	Limit  int
+	Offset int
+}
+
+type CustomerList struct {
+	Customers []User `json:"customers"`
+	Total     int    `json:"total"`
+}
+
+// columns a customer list can be sorted by, the order clause can't be a query parameter
+var customerSortColumns = map[string]string{
+	"name":       "last_name, first_name",
+	"email":      "email",
+	"created_at": "created_at",
+}
+
+// Search lists customers whose name, email or phone contain the search term
+func (s *CustomerStorage) Search(ctx context.Context, q CustomerQuery) (*CustomerList, error) {
+	sortColumns, ok := customerSortColumns[q.Sort]
+	if !ok {
+		sortColumns = customerSortColumns["name"]
+	}
+	order := "ASC"
+	if q.Order == "desc" {
+		order = "DESC"
+	}
+	columns := strings.Split(sortColumns, ", ")
+	for i := range columns {
+		columns[i] += " " + order
+	}
+
+	query := `
+		SELECT id, first_name, last_name, username, COALESCE(email, ''), phone, is_walk_in, is_active, created_at, COUNT(*) OVER()
+		FROM users
+		WHERE roles = 'customer' AND deleted_at IS NULL AND (
+			$1 = ''
+			OR first_name || ' ' || last_name ILIKE '%' || $1 || '%'
+			OR email ILIKE '%' || $1 || '%'
+			OR phone LIKE '%' || $1 || '%'
+		)
+		ORDER BY ` + strings.Join(columns, ", ") + `, id
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Search, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &CustomerList{Customers: []User{}}
+	for rows.Next() {
+		customer := User{Role: RoleCustomer}
+		if err := rows.Scan(
+			&customer.ID,
+			&customer.FirstName,
+			&customer.LastName,
+			&customer.Username,
+			&customer.Email,
+			&customer.Phone,
+			&customer.IsWalkIn,
+			&customer.IsActive,
+			&customer.Created_at,
+			&list.Total,
+		); err != nil {
+			return nil, err
+		}
+		list.Customers = append(list.Customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//the window count is missing when the offset is past the last row
+	if len(list.Customers) == 0 && q.Offset > 0 {
+		query = `
+			SELECT COUNT(*) FROM users
+			WHERE roles = 'customer' AND deleted_at IS NULL AND (
+				$1 = ''
+				OR first_name || ' ' || last_name ILIKE '%' || $1 || '%'
+				OR email ILIKE '%' || $1 || '%'
+				OR phone LIKE '%' || $1 || '%'
+			)
+		`
+		if err := s.db.QueryRowContext(ctx, query, q.Search).Scan(&list.Total); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// CreateWalkIn stores a customer who booked in person, the record has no password and can't log in
+// until the customer registers with the same email
+func (s *CustomerStorage) CreateWalkIn(ctx context.Context, customer *User) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return createWalkIn(ctx, tx, customer)
+	})
+}
+
+// walk-ins get a generated username since nobody picked one,
+// the caller decides if the phone counts as verified and which channel the customer is notified on
+func createWalkIn(ctx context.Context, tx *sql.Tx, customer *User) error {
+	query := `
+		INSERT INTO users (username, first_name, last_name, email, phone, password, roles, is_active, is_walk_in, locale, phone_verified_at, notification_channel)
+		VALUES ('walkin-' || substr(md5(random()::text), 1, 12), $1, $2, NULLIF($3, ''), $4, ''::bytea, $5, FALSE, TRUE, COALESCE(NULLIF($6, ''), 'bs'), $7, COALESCE(NULLIF($8, ''), 'email'))
+		RETURNING id, username, created_at, locale, notification_channel
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	customer.Role = RoleCustomer
+	customer.IsWalkIn = true
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		customer.FirstName,
+		customer.LastName,
+		customer.Email,
+		customer.Phone,
+		customer.Role,
+		customer.Locale,
+		customer.PhoneVerifiedAt,
+		customer.NotificationChannel,
+	).Scan(
+		&customer.ID,
+		&customer.Username,
+		&customer.Created_at,
+		&customer.Locale,
+		&customer.NotificationChannel,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type EmailChangeStorage struct {
+	db *sql.DB
+}
+
+// CreateRequest replaces any pending email change of the user with a new one
+func (s *EmailChangeStorage) CreateRequest(ctx context.Context, userID int64, newEmail, plainToken string, expiration time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM email_change_requests WHERE user_id = $1;
+		`
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO email_change_requests (id, user_id, new_email, expires_at)
+			VALUES ($1, $2, $3, $4);
+		`
+		rows, err := tx.ExecContext(
+			ctx,
+			query,
+			hashToken(plainToken),
+			userID,
+			newEmail,
+			time.Now().Add(expiration),
+		)
+		if err != nil {
+			return err
+		}
+
+		n, _ := rows.RowsAffected()
+		if n == 0 {
+			return Error_TableNotUpdated
+		}
+		return nil
+	})
+}
+
+func (s *EmailChangeStorage) DeleteRequest(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM email_change_requests WHERE user_id = $1;
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Confirm consumes the token and moves the user to the new email
+func (s *EmailChangeStorage) Confirm(ctx context.Context, plainToken string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM email_change_requests
+			WHERE id = $1
+			RETURNING user_id, new_email, expires_at
+		`
+		var (
+			userID    int64
+			newEmail  string
+			expiresAt time.Time
+		)
+		err := tx.QueryRowContext(ctx, query, hashToken(plainToken)).Scan(
+			&userID,
+			&newEmail,
+			&expiresAt,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+		if time.Now().Compare(expiresAt) >= 0 {
+			return Error_Expired
+		}
+
+		query = `
+			UPDATE users SET email = $1
+			WHERE id = $2
+		`
+		_, err = tx.ExecContext(ctx, query, newEmail, userID)
+		return err
+	})
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// EmailTemplate replaces the subject and body of an embedded template in one locale
+type EmailTemplate struct {
+	Name      string    `json:"name"`
+	Locale    string    `json:"locale"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	UpdatedBy *int64    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type EmailTemplateStorage struct {
+	db *sql.DB
+}
+
+func (s *EmailTemplateStorage) Get(ctx context.Context, name, locale string) (*EmailTemplate, error) {
+	query := `
+		SELECT name, locale, subject, body, updated_by, updated_at
+		FROM email_templates
+		WHERE name = $1 AND locale = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	emailTemplate := &EmailTemplate{}
+	err := s.db.QueryRowContext(ctx, query, name, locale).Scan(
+		&emailTemplate.Name,
+		&emailTemplate.Locale,
+		&emailTemplate.Subject,
+		&emailTemplate.Body,
+		&emailTemplate.UpdatedBy,
+		&emailTemplate.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return emailTemplate, nil
+}
+
+func (s *EmailTemplateStorage) List(ctx context.Context) ([]EmailTemplate, error) {
+	query := `
+		SELECT name, locale, subject, body, updated_by, updated_at
+		FROM email_templates
+		ORDER BY name, locale
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emailTemplates := []EmailTemplate{}
+	for rows.Next() {
+		var emailTemplate EmailTemplate
+		err := rows.Scan(
+			&emailTemplate.Name,
+			&emailTemplate.Locale,
+			&emailTemplate.Subject,
+			&emailTemplate.Body,
+			&emailTemplate.UpdatedBy,
+			&emailTemplate.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		emailTemplates = append(emailTemplates, emailTemplate)
+	}
+	return emailTemplates, rows.Err()
+}
+
+func (s *EmailTemplateStorage) Upsert(ctx context.Context, emailTemplate *EmailTemplate) error {
+	query := `
+		INSERT INTO email_templates (name, locale, subject, body, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (name, locale) DO UPDATE SET
+			subject = EXCLUDED.subject,
+			body = EXCLUDED.body,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		emailTemplate.Name,
+		emailTemplate.Locale,
+		emailTemplate.Subject,
+		emailTemplate.Body,
+		emailTemplate.UpdatedBy,
+	).Scan(
+		&emailTemplate.UpdatedAt,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Delete removes the override so the embedded template is sent again
+func (s *EmailTemplateStorage) Delete(ctx context.Context, name, locale string) error {
+	query := `
+		DELETE FROM email_templates WHERE name = $1 AND locale = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, name, locale)
+	if err != nil {
+		return translateError(err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
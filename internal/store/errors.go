@@ -0,0 +1,56 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	Error_InvalidReference = errors.New("a referenced record doesn't exist")
+	Error_InvalidValue     = errors.New("the value isn't allowed")
+	Error_Retry            = errors.New("the change collided with a concurrent one, try again")
+)
+
+// postgres error codes the store translates, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation      = "23505"
+	pqForeignKeyViolation  = "23503"
+	pqCheckViolation       = "23514"
+	pqExclusionViolation   = "23P01"
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// constraints whose violation has a more specific error than the generic one for its kind
+var constraintErrors = map[string]error{
+	"users_email_key":              Error_DuplicateEmail,
+	"users_username_key":           Error_DuplicateUsername,
+	"time_slots_no_overlap":        Error_SlotOverlap,
+	"idx_appointments_active_slot": Error_NotFound, //someone else booked the slot first
+}
+
+// translateError turns a postgres error into the typed store error for it,
+// any other error is returned as it is
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation, pqExclusionViolation:
+		if constraintErr, ok := constraintErrors[pqErr.Constraint]; ok {
+			return constraintErr
+		}
+		return Error_Conflict
+	case pqForeignKeyViolation:
+		return Error_InvalidReference
+	case pqCheckViolation:
+		return Error_InvalidValue
+	case pqSerializationFailure, pqDeadlockDetected:
+		return Error_Retry
+	default:
+		return err
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTranslateError(t *testing.T) {
+	other := errors.New("connection refused")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"overlapping slot", &pq.Error{Code: pqExclusionViolation, Constraint: "time_slots_no_overlap"}, Error_SlotOverlap},
+		{"wrapped overlapping slot", fmt.Errorf("creating slot: %w", &pq.Error{Code: pqExclusionViolation, Constraint: "time_slots_no_overlap"}), Error_SlotOverlap},
+		{"slot booked by someone else", &pq.Error{Code: pqUniqueViolation, Constraint: "idx_appointments_active_slot"}, Error_NotFound},
+		{"duplicate email", &pq.Error{Code: pqUniqueViolation, Constraint: "users_email_key"}, Error_DuplicateEmail},
+		{"duplicate username", &pq.Error{Code: pqUniqueViolation, Constraint: "users_username_key"}, Error_DuplicateUsername},
+		{"other unique constraint", &pq.Error{Code: pqUniqueViolation, Constraint: "roles_name_key"}, Error_Conflict},
+		{"foreign key", &pq.Error{Code: pqForeignKeyViolation}, Error_InvalidReference},
+		{"check", &pq.Error{Code: pqCheckViolation}, Error_InvalidValue},
+		{"serialization failure", &pq.Error{Code: pqSerializationFailure}, Error_Retry},
+		{"deadlock", &pq.Error{Code: pqDeadlockDetected}, Error_Retry},
+		{"not a postgres error", other, other},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := translateError(test.err); got != test.want {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if got := translateError(nil); got != nil {
+		t.Fatalf("got %v for no error", got)
+	}
+}
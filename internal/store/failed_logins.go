@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type FailedLoginStats struct {
+	ByEmail     int
+	ByIP        int
+	LastByEmail *time.Time
+}
+
+type FailedLoginStorage struct {
+	db *sql.DB
+}
+
+func (s *FailedLoginStorage) Record(ctx context.Context, email, ip string) error {
+	query := `
+		INSERT INTO failed_logins (email, ip) VALUES ($1, $2);
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, email, ip)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Stats counts the failures for the account and for the ip since the given time
+func (s *FailedLoginStorage) Stats(ctx context.Context, email, ip string, since time.Time) (*FailedLoginStats, error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE email = $1),
+			COUNT(*) FILTER (WHERE ip = $2),
+			MAX(created_at) FILTER (WHERE email = $1)
+		FROM failed_logins
+		WHERE (email = $1 OR ip = $2) AND created_at > $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var stats FailedLoginStats
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		email,
+		ip,
+		since,
+	).Scan(
+		&stats.ByEmail,
+		&stats.ByIP,
+		&stats.LastByEmail,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Clear forgets the failures of an account after a successful login or an unlock
+func (s *FailedLoginStorage) Clear(ctx context.Context, email string) error {
+	query := `
+		DELETE FROM failed_logins WHERE email = $1;
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, email)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteBefore removes the failures recorded before the cutoff, they no longer count towards a lockout
+func (s *FailedLoginStorage) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM failed_logins WHERE created_at < $1;
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return rows.RowsAffected()
+}
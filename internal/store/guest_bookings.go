@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	Error_TooManyHolds = errors.New("too many bookings are waiting for confirmation, confirm one or try again later")
+)
+
+type GuestBookingRequest struct {
+	SlotID    int64
+	WorkerID  int64
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Locale    string
+	ExpiresAt time.Time
+}
+
+type GuestBooking struct {
+	Customer *User
+	Slot     BookedSlot
+}
+
+type GuestBookingStorage struct {
+	db *sql.DB
+}
+
+// Hold creates a pending appointment for the slot until the request expires so nobody else can take it
+// while the guest confirms the booking. An email can hold at most maxHolds slots at once,
+// beyond that Error_TooManyHolds is returned until one of them is confirmed or runs out.
+func (s *GuestBookingStorage) Hold(ctx context.Context, request *GuestBookingRequest, plainToken string, maxHolds int) (*time.Time, error) {
+	var slot *BookedSlot
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT COUNT(*) FROM guest_booking_requests WHERE email = $1 AND expires_at > NOW()
+		`
+		var holds int
+		if err := tx.QueryRowContext(ctx, query, request.Email).Scan(&holds); err != nil {
+			return err
+		}
+		if holds >= maxHolds {
+			return Error_TooManyHolds
+		}
+
+		query = `
+			SELECT 1 FROM time_slots WHERE id = $1 AND start_time > NOW()
+		`
+		var exists int
+		if err := tx.QueryRowContext(ctx, query, request.SlotID).Scan(&exists); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+
+		var err error
+		slot, err = bookSlot(ctx, tx, newAppointment{
+			SlotID:        request.SlotID,
+			WorkerID:      &request.WorkerID,
+			Status:        StatusPending,
+			HoldExpiresAt: &request.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: slot.AppointmentID,
+			SlotID:        &slot.ID,
+			FromStatus:    StatusAvailable,
+			ToStatus:      StatusPending,
+			Reason:        "guest booking",
+		})
+		if err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO guest_booking_requests (token, appointment_id, first_name, last_name, email, phone, locale, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+		_, err = tx.ExecContext(
+			ctx,
+			query,
+			hashToken(plainToken),
+			slot.AppointmentID,
+			request.FirstName,
+			request.LastName,
+			request.Email,
+			request.Phone,
+			request.Locale,
+			request.ExpiresAt,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &slot.StartTime, nil
+}
+
+// Confirm books the held slot for the customer with the guest's email, a walk-in customer
+// record is created when there is none so a later registration with the email takes the booking over
+func (s *GuestBookingStorage) Confirm(ctx context.Context, plainToken string) (*GuestBooking, error) {
+	booking := &GuestBooking{}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM guest_booking_requests
+			WHERE token = $1
+			RETURNING appointment_id, first_name, last_name, email, phone, locale, expires_at
+		`
+		var (
+			appointmentID int64
+			request       GuestBookingRequest
+		)
+		err := tx.QueryRowContext(ctx, query, hashToken(plainToken)).Scan(
+			&appointmentID,
+			&request.FirstName,
+			&request.LastName,
+			&request.Email,
+			&request.Phone,
+			&request.Locale,
+			&request.ExpiresAt,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+		if time.Now().Compare(request.ExpiresAt) >= 0 {
+			return Error_Expired
+		}
+
+		customer := &User{Role: RoleCustomer}
+		query = `
+			SELECT id, username, first_name, last_name, roles, is_walk_in, locale, phone, phone_verified_at, notification_channel FROM users
+			WHERE email = $1
+			FOR UPDATE
+		`
+		err = tx.QueryRowContext(ctx, query, request.Email).Scan(
+			&customer.ID,
+			&customer.Username,
+			&customer.FirstName,
+			&customer.LastName,
+			&customer.Role,
+			&customer.IsWalkIn,
+			&customer.Locale,
+			&customer.Phone,
+			&customer.PhoneVerifiedAt,
+			&customer.NotificationChannel,
+		)
+		switch err {
+		case nil:
+			if customer.Role != RoleCustomer {
+				return Error_DuplicateEmail
+			}
+			customer.Email = request.Email
+		case sql.ErrNoRows:
+			customer.FirstName = request.FirstName
+			customer.LastName = request.LastName
+			customer.Email = request.Email
+			customer.Phone = &request.Phone
+			customer.Locale = request.Locale
+			if err := createWalkIn(ctx, tx, customer); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		query = `
+			UPDATE appointments
+			SET status = 'booked', customer_id = $2, hold_expires_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND status = 'pending' AND hold_expires_at > NOW()
+			RETURNING id, slot_id, start_time, worker_id, customer_id
+		`
+		var slotID sql.NullInt64
+		err = tx.QueryRowContext(ctx, query, appointmentID, customer.ID).Scan(
+			&booking.Slot.AppointmentID,
+			&slotID,
+			&booking.Slot.StartTime,
+			&booking.Slot.WorkerID,
+			&booking.Slot.CustomerID,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_Expired
+			default:
+				return err
+			}
+		}
+		booking.Slot.ID = slotID.Int64
+		booking.Customer = customer
+
+		return recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: appointmentID,
+			SlotID:        &booking.Slot.ID,
+			CustomerID:    &customer.ID,
+			FromStatus:    StatusPending,
+			ToStatus:      StatusBooked,
+			ActorID:       &customer.ID,
+			Reason:        "guest booking confirmed",
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+// Delete drops the request and releases the held slot
+func (s *GuestBookingStorage) Delete(ctx context.Context, plainToken string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM guest_booking_requests WHERE token = $1
+			RETURNING appointment_id
+		`
+		var appointmentID int64
+		err := tx.QueryRowContext(ctx, query, hashToken(plainToken)).Scan(&appointmentID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+
+		if err := endAppointment(ctx, tx, appointmentID, StatusExpired); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: appointmentID,
+			FromStatus:    StatusPending,
+			ToStatus:      StatusExpired,
+			Reason:        "guest booking not sent",
+		})
+	})
+}
+
+// ReleaseExpiredHolds expires the guest bookings that were never confirmed and frees their slots
+func (s *GuestBookingStorage) ReleaseExpiredHolds(ctx context.Context) (int64, error) {
+	var released int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM guest_booking_requests WHERE expires_at <= NOW()
+		`
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+
+		query = `
+			WITH expired AS (
+				UPDATE appointments
+				SET status = 'expired', hold_expires_at = NULL, updated_at = NOW()
+				WHERE status = 'pending' AND hold_expires_at <= NOW()
+				RETURNING id, slot_id
+			), freed AS (
+				UPDATE time_slots SET is_booked = FALSE
+				WHERE id IN (SELECT slot_id FROM expired)
+			)
+			INSERT INTO appointment_events (appointment_id, slot_id, from_status, to_status, reason)
+			SELECT id, slot_id, 'pending', 'expired', 'guest booking not confirmed' FROM expired
+		`
+		rows, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		released, err = rows.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return released, nil
+}
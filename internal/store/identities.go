@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Identity links an account at an external OpenID Connect provider to a user
+type Identity struct {
+	Provider string
+	Subject  string
+	Email    string
+}
+
+func (u *UserStorage) GetByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT user_id FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := u.db.QueryRowContext(
+		ctx,
+		query,
+		provider,
+		subject,
+	).Scan(
+		&userID,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return u.GetByID(ctx, userID)
+}
+
+// LinkOrCreateByIdentity links the identity to the user with the same (provider verified) email,
+// or creates a new active user from the given one when there is no such account yet.
+// An existing account that was never activated gets activated since the provider verified the email,
+// its password is cleared because whoever registered it never proved they own the email.
+func (u *UserStorage) LinkOrCreateByIdentity(ctx context.Context, user *User, identity Identity) error {
+	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, is_active FROM users WHERE email = $1 FOR UPDATE
+		`
+		var (
+			existingID int64
+			wasActive  bool
+		)
+		err := tx.QueryRowContext(ctx, query, identity.Email).Scan(&existingID, &wasActive)
+
+		switch err {
+		case nil:
+			user.ID = existingID
+			if !wasActive {
+				query = `
+					UPDATE users SET password = ''::bytea WHERE id = $1
+				`
+				if _, err := tx.ExecContext(ctx, query, user.ID); err != nil {
+					return err
+				}
+			}
+		case sql.ErrNoRows:
+			if err := u.Create(ctx, tx, user); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		user.IsActive = true
+		if err := updateUserStatus(ctx, tx, user); err != nil {
+			return err
+		}
+		//a walk-in record becomes a regular account once its owner logs in
+		query = `
+			UPDATE users SET is_walk_in = FALSE WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, user.ID); err != nil {
+			return err
+		}
+		if err := deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO user_identities (provider, subject, user_id, email)
+			VALUES ($1, $2, $3, $4)
+		`
+		_, err = tx.ExecContext(
+			ctx,
+			query,
+			identity.Provider,
+			identity.Subject,
+			user.ID,
+			identity.Email,
+		)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func deleteUserInvitations(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+		DELETE FROM user_invitations WHERE user_id = $1
+	`
+
+	_, err := tx.ExecContext(
+		ctx,
+		query,
+		userID,
+	)
+
+	if err != nil {
+		return err
+	}
+	return nil
+}
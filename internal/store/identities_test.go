@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLinkOrCreateByIdentity(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	t.Run("creates an active user for a new email", func(t *testing.T) {
+		user := &User{Username: "new_user", FirstName: "New", LastName: "User", Email: "new@example.com", Role: RoleCustomer}
+		identity := Identity{Provider: "google", Subject: "sub-new", Email: "new@example.com"}
+		if err := storage.Users.LinkOrCreateByIdentity(ctx, user, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		linked, err := storage.Users.GetByIdentity(ctx, "google", "sub-new")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked.ID != user.ID || !linked.IsActive {
+			t.Fatalf("got user %d active %t, want %d active", linked.ID, linked.IsActive, user.ID)
+		}
+	})
+
+	t.Run("keeps the password of an active account", func(t *testing.T) {
+		owner := &User{Username: "active_user", FirstName: "Active", LastName: "User", Email: "active@example.com", Role: RoleCustomer}
+		if err := owner.Password.Set("owner-password"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Users.CreateAndInvite(ctx, owner, "active-token", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Users.Activate(ctx, "active-token"); err != nil {
+			t.Fatal(err)
+		}
+
+		identity := Identity{Provider: "google", Subject: "sub-active", Email: "active@example.com"}
+		if err := storage.Users.LinkOrCreateByIdentity(ctx, &User{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := storage.Users.GetByEmail(ctx, "active@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != owner.ID {
+			t.Fatalf("linked to user %d, want %d", user.ID, owner.ID)
+		}
+		if !user.Password.ComparePasswords("owner-password") {
+			t.Fatal("the password of an activated account was cleared")
+		}
+	})
+
+	t.Run("clears the password of an account that was never activated", func(t *testing.T) {
+		//someone registered the email before its owner, the provider proves the email belongs to the owner
+		squatter := &User{Username: "squatter", FirstName: "Not", LastName: "Owner", Email: "victim@example.com", Role: RoleCustomer}
+		if err := squatter.Password.Set("squatter-password"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Users.CreateAndInvite(ctx, squatter, "squatter-token", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		identity := Identity{Provider: "google", Subject: "sub-victim", Email: "victim@example.com"}
+		if err := storage.Users.LinkOrCreateByIdentity(ctx, &User{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := storage.Users.GetByEmail(ctx, "victim@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != squatter.ID || !user.IsActive {
+			t.Fatalf("got user %d active %t, want %d active", user.ID, user.IsActive, squatter.ID)
+		}
+		if user.Password.ComparePasswords("squatter-password") {
+			t.Fatal("the password set before the email was verified still logs in")
+		}
+		//the invitation can't activate the account a second time
+		if err := storage.Users.Activate(ctx, "squatter-token"); err == nil {
+			t.Fatal("the invitation of the linked account was kept")
+		}
+	})
+
+	t.Run("turns a walk-in into a regular account", func(t *testing.T) {
+		walkInID := createTestUser(t, db, "walkin@example.com", RoleCustomer, false)
+		if _, err := db.ExecContext(ctx, `UPDATE users SET is_walk_in = TRUE WHERE id = $1`, walkInID); err != nil {
+			t.Fatal(err)
+		}
+
+		identity := Identity{Provider: "apple", Subject: "sub-walkin", Email: "walkin@example.com"}
+		if err := storage.Users.LinkOrCreateByIdentity(ctx, &User{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := storage.Users.GetByIdentity(ctx, "apple", "sub-walkin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != walkInID || user.IsWalkIn || !user.IsActive {
+			t.Fatalf("got user %d walk-in %t active %t, want %d as an active regular account", user.ID, user.IsWalkIn, user.IsActive, walkInID)
+		}
+	})
+}
+
+func TestOIDCStateRoundTrip(t *testing.T) {
+	storage, _ := newTestStorage(t)
+	ctx := context.Background()
+
+	loginState := &OIDCLoginState{
+		State:        "state-1",
+		Provider:     "google",
+		Nonce:        "nonce-1",
+		CodeVerifier: "verifier-1",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}
+	if err := storage.OIDCStates.Create(ctx, loginState); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.OIDCStates.Consume(ctx, "state-1", "apple"); err != Error_NotFound {
+		t.Fatalf("consuming the state for another provider: got %v, want %v", err, Error_NotFound)
+	}
+
+	consumed, err := storage.OIDCStates.Consume(ctx, "state-1", "google")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed.Nonce != "nonce-1" || consumed.CodeVerifier != "verifier-1" {
+		t.Fatalf("got nonce %q verifier %q", consumed.Nonce, consumed.CodeVerifier)
+	}
+
+	if _, err := storage.OIDCStates.Consume(ctx, "state-1", "google"); err != Error_NotFound {
+		t.Fatalf("consuming the state twice: got %v, want %v", err, Error_NotFound)
+	}
+
+	expired := &OIDCLoginState{
+		State:        "state-2",
+		Provider:     "google",
+		Nonce:        "nonce-2",
+		CodeVerifier: "verifier-2",
+		ExpiresAt:    time.Now().Add(-time.Second),
+	}
+	if err := storage.OIDCStates.Create(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.OIDCStates.Consume(ctx, "state-2", "google"); err != Error_Expired {
+		t.Fatalf("consuming an expired state: got %v, want %v", err, Error_Expired)
+	}
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	Error_TooLateToChange = errors.New("the appointment can no longer be changed")
+)
+
+// ManagedBooking is the booking behind a manage link
+type ManagedBooking struct {
+	AppointmentID   int64     `json:"appointment_id"`
+	SlotID          *int64    `json:"slot_id"`
+	StartTime       time.Time `json:"start_time"`
+	Service         string    `json:"service"`
+	Status          string    `json:"status"`
+	WorkerID        int64     `json:"worker_id"`
+	WorkerFirstName string    `json:"worker_first_name"`
+	CustomerID      int64     `json:"customer_id"`
+	CanChange       bool      `json:"can_change"`
+}
+
+// SetManageToken stores the hashed token of the appointment's manage link, replacing an older one
+func (s *TimeSlotsStorage) SetManageToken(ctx context.Context, appointmentID int64, plainToken string) error {
+	query := `
+		UPDATE appointments SET manage_token = $2, updated_at = NOW()
+		WHERE id = $1 AND status NOT IN ` + inactiveStatuses + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.ExecContext(ctx, query, appointmentID, hashToken(plainToken))
+	if err != nil {
+		return translateError(err)
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+func (s *TimeSlotsStorage) GetByManageToken(ctx context.Context, plainToken, cancellationWindow string) (*ManagedBooking, error) {
+	query := `
+		SELECT a.id, a.slot_id, a.start_time, a.service, a.status, w.id, w.first_name, a.customer_id,
+			a.status = 'booked' AND NOW() + $2::INTERVAL < a.start_time
+		FROM appointments a
+		JOIN users w ON w.id = a.worker_id
+		WHERE a.manage_token = $1 AND a.customer_id IS NOT NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var booking ManagedBooking
+	err := s.db.QueryRowContext(ctx, query, hashToken(plainToken), cancellationWindow).Scan(
+		&booking.AppointmentID,
+		&booking.SlotID,
+		&booking.StartTime,
+		&booking.Service,
+		&booking.Status,
+		&booking.WorkerID,
+		&booking.WorkerFirstName,
+		&booking.CustomerID,
+		&booking.CanChange,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return &booking, nil
+}
+
+// CancelByManageToken cancels the appointment and frees its slot as long as it's outside the cancellation window
+func (s *TimeSlotsStorage) CancelByManageToken(ctx context.Context, plainToken, reason, cancellationWindow string) (*ManagedBooking, error) {
+	var booking *ManagedBooking
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		booking, err = lockManagedBooking(ctx, tx, plainToken, cancellationWindow)
+		if err != nil {
+			return err
+		}
+		if err := endAppointment(ctx, tx, booking.AppointmentID, StatusCancelledByCustomer); err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: booking.AppointmentID,
+			SlotID:        booking.SlotID,
+			CustomerID:    &booking.CustomerID,
+			FromStatus:    StatusBooked,
+			ToStatus:      StatusCancelledByCustomer,
+			ActorID:       &booking.CustomerID,
+			Reason:        reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	booking.Status = StatusCancelledByCustomer
+	booking.CanChange = false
+	return booking, nil
+}
+
+// RescheduleByManageToken cancels the appointment and books the customer into another free slot,
+// the manage token moves to the new appointment so the link keeps working
+func (s *TimeSlotsStorage) RescheduleByManageToken(ctx context.Context, plainToken string, newSlotID int64, cancellationWindow string) (*ManagedBooking, error) {
+	var booking *ManagedBooking
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		old, err := lockManagedBooking(ctx, tx, plainToken, cancellationWindow)
+		if err != nil {
+			return err
+		}
+		if err := endAppointment(ctx, tx, old.AppointmentID, StatusCancelledByCustomer); err != nil {
+			return err
+		}
+		err = recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: old.AppointmentID,
+			SlotID:        old.SlotID,
+			CustomerID:    &old.CustomerID,
+			FromStatus:    StatusBooked,
+			ToStatus:      StatusCancelledByCustomer,
+			ActorID:       &old.CustomerID,
+			Reason:        "rescheduled",
+		})
+		if err != nil {
+			return err
+		}
+
+		query := `
+			SELECT 1 FROM time_slots WHERE id = $1 AND start_time > NOW()
+		`
+		var exists int
+		if err := tx.QueryRowContext(ctx, query, newSlotID).Scan(&exists); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+
+		slot, err := bookSlot(ctx, tx, newAppointment{
+			SlotID:     newSlotID,
+			CustomerID: &old.CustomerID,
+			Status:     StatusBooked,
+			Service:    old.Service,
+		})
+		if err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE appointments a SET manage_token = $2
+			FROM users w
+			WHERE a.id = $1 AND w.id = a.worker_id
+			RETURNING w.first_name
+		`
+		booking = &ManagedBooking{
+			AppointmentID: slot.AppointmentID,
+			SlotID:        &slot.ID,
+			StartTime:     slot.StartTime,
+			Service:       old.Service,
+			Status:        StatusBooked,
+			WorkerID:      slot.WorkerID,
+			CustomerID:    old.CustomerID,
+			CanChange:     true,
+		}
+		err = tx.QueryRowContext(ctx, query, slot.AppointmentID, hashToken(plainToken)).Scan(&booking.WorkerFirstName)
+		if err != nil {
+			return err
+		}
+
+		return recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: slot.AppointmentID,
+			SlotID:        &slot.ID,
+			CustomerID:    &old.CustomerID,
+			FromStatus:    StatusAvailable,
+			ToStatus:      StatusBooked,
+			ActorID:       &old.CustomerID,
+			Reason:        "rescheduled",
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+func lockManagedBooking(ctx context.Context, tx *sql.Tx, plainToken, cancellationWindow string) (*ManagedBooking, error) {
+	query := `
+		SELECT a.id, a.slot_id, a.start_time, a.service, a.status, a.worker_id, a.customer_id,
+			NOW() + $2::INTERVAL < a.start_time
+		FROM appointments a
+		WHERE a.manage_token = $1 AND a.status = 'booked' AND a.customer_id IS NOT NULL
+		FOR UPDATE
+	`
+	var booking ManagedBooking
+	err := tx.QueryRowContext(ctx, query, hashToken(plainToken), cancellationWindow).Scan(
+		&booking.AppointmentID,
+		&booking.SlotID,
+		&booking.StartTime,
+		&booking.Service,
+		&booking.Status,
+		&booking.WorkerID,
+		&booking.CustomerID,
+		&booking.CanChange,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	if !booking.CanChange {
+		return nil, Error_TooLateToChange
+	}
+	return &booking, nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// notifications are sent for these appointment transitions
+const (
+	NotificationCancelledByCustomer = StatusCancelledByCustomer
+	NotificationCancelledByShop     = StatusCancelledByShop
+	NotificationMissed              = StatusMissed
+	NotificationReminder            = "reminder"
+)
+
+const (
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliverySkipped = "skipped" //the recipient has neither an email nor a verified phone
+)
+
+type AppointmentNotification struct {
+	ID            int64     `json:"id"`
+	AppointmentID int64     `json:"appointment_id"`
+	SlotID        *int64    `json:"slot_id"`
+	Event         string    `json:"event"`
+	ActorID       *int64    `json:"actor_id"`
+	RecipientID   int64     `json:"recipient_id"`
+	Reason        string    `json:"reason"`
+	Delivery      string    `json:"delivery"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type NotificationStorage struct {
+	db *sql.DB
+}
+
+func (s *NotificationStorage) Record(ctx context.Context, notification *AppointmentNotification) error {
+	query := `
+		INSERT INTO appointment_notifications (appointment_id, slot_id, event, actor_id, recipient_id, reason, delivery)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		notification.AppointmentID,
+		notification.SlotID,
+		notification.Event,
+		notification.ActorID,
+		notification.RecipientID,
+		notification.Reason,
+		notification.Delivery,
+	).Scan(
+		&notification.ID,
+		&notification.CreatedAt,
+	)
+	return translateError(err)
+}
+
+// ClaimDueReminders marks the booked appointments starting before until as reminded and returns them,
+// an appointment is claimed once even when several instances run the job
+func (s *NotificationStorage) ClaimDueReminders(ctx context.Context, until time.Time) ([]BookedSlot, error) {
+	query := `
+		UPDATE appointments SET reminded_at = NOW()
+		WHERE id IN (
+			SELECT id FROM appointments
+			WHERE status = 'booked' AND reminded_at IS NULL AND customer_id IS NOT NULL
+				AND start_time > NOW() AND start_time <= $1
+			ORDER BY start_time
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, COALESCE(slot_id, 0), start_time, worker_id, customer_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, until)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	var due []BookedSlot
+	for rows.Next() {
+		var slot BookedSlot
+		err := rows.Scan(
+			&slot.AppointmentID,
+			&slot.ID,
+			&slot.StartTime,
+			&slot.WorkerID,
+			&slot.CustomerID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, slot)
+	}
+	return due, rows.Err()
+}
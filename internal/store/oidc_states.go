@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type OIDCLoginState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+type OIDCStateStorage struct {
+	db *sql.DB
+}
+
+func (s *OIDCStateStorage) Create(ctx context.Context, loginState *OIDCLoginState) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	//abandoned logins never reach Consume, so clean them up here
+	query := `
+		DELETE FROM oidc_login_states WHERE expires_at < $1;
+	`
+	if _, err := s.db.ExecContext(ctx, query, time.Now()); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		loginState.State,
+		loginState.Provider,
+		loginState.Nonce,
+		loginState.CodeVerifier,
+		loginState.ExpiresAt,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Consume deletes the state so it can be used only once and returns it if it hasn't expired
+func (s *OIDCStateStorage) Consume(ctx context.Context, state, provider string) (*OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state = $1 AND provider = $2
+		RETURNING state, provider, nonce, code_verifier, expires_at;
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var loginState OIDCLoginState
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		state,
+		provider,
+	).Scan(
+		&loginState.State,
+		&loginState.Provider,
+		&loginState.Nonce,
+		&loginState.CodeVerifier,
+		&loginState.ExpiresAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if time.Now().Compare(loginState.ExpiresAt) >= 0 {
+		return nil, Error_Expired
+	}
+	return &loginState, nil
+}
@@ -2,9 +2,7 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"log"
 	"time"
@@ -42,7 +40,7 @@ func (u *PasswordManagerStorage) CreateResetPasswordRequest(ctx context.Context,
 	)
 
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	n, _ := rows.RowsAffected()
@@ -112,7 +110,7 @@ func (u *PasswordManagerStorage) UpdatePassword(ctx context.Context, newPassword
 	)
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	num, _ := rows.RowsAffected()
@@ -136,13 +134,10 @@ func (u *PasswordManagerStorage) getValidUserFromToken(ctx context.Context, plai
 	var expTime time.Time
 	var passwordHash []byte
 
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-
 	err := u.db.QueryRowContext(
 		ctx,
 		query,
-		hashToken,
+		hashToken(plainToken),
 	).Scan(
 		&userID,
 		&expTime,
@@ -155,3 +150,84 @@ func (u *PasswordManagerStorage) getValidUserFromToken(ctx context.Context, plai
 
 	return &userID, &expTime, &passwordHash
 }
+
+// GetUserByResetToken returns the user a reset token was issued for, so the new
+// password can be checked against their personal info before anything changes
+func (u *PasswordManagerStorage) GetUserByResetToken(ctx context.Context, plainToken string) (*User, error) {
+	query := `
+		SELECT u.id, u.email, u.username, u.first_name, u.last_name
+		FROM reset_password_requests r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.id = $1;
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	err := u.db.QueryRowContext(
+		ctx,
+		query,
+		hashToken(plainToken),
+	).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Username,
+		&user.FirstName,
+		&user.LastName,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// ChangePassword sets a new password for a logged in user and invalidates every token issued before validAfter
+func (u *PasswordManagerStorage) ChangePassword(ctx context.Context, userID int64, newPassword password, validAfter time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `
+		SELECT password FROM users WHERE id = $1
+	`
+	var currentPassword password
+	err := u.db.QueryRowContext(ctx, query, userID).Scan(&currentPassword.hash)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return Error_NotFound
+		default:
+			return err
+		}
+	}
+
+	if currentPassword.ComparePasswords(*newPassword.plain) {
+		return Error_SamePassword
+	}
+
+	query = `
+		UPDATE users
+		SET password = $1, tokens_valid_after = $2
+		WHERE id = $3;
+	`
+	rows, err := u.db.ExecContext(
+		ctx,
+		query,
+		newPassword.hash,
+		validAfter,
+		userID,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+
+	num, _ := rows.RowsAffected()
+	if num == 0 {
+		return Error_TableNotUpdated
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	Error_InvalidCode         = errors.New("the verification code is wrong")
+	Error_PhoneNotVerified    = errors.New("the phone number isn't verified")
+	Error_TooManyCodeRequests = errors.New("too many verification codes were requested, try again later")
+)
+
+const (
+	// a code can be guessed this many times before a new one has to be requested
+	maxPhoneCodeAttempts = 5
+	// the attempts are shared by every code sent within the window, resending doesn't reset them
+	phoneCodeAttemptWindow = time.Hour * 24
+)
+
+type PhoneVerificationStorage struct {
+	db *sql.DB
+}
+
+// CreateRequest replaces any pending verification of the user with a new code for the phone.
+// A new code is refused with Error_TooManyCodeRequests within cooldown of the last one sent to the user
+// or to the phone, or once the user guessed wrong too often in the window, retryAt is when it's allowed again.
+func (s *PhoneVerificationStorage) CreateRequest(ctx context.Context, userID int64, phone, code string, expiration, cooldown time.Duration) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var retryAt *time.Time
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		//the user's pending request is locked so two resends can't both pass the checks
+		query := `
+			SELECT attempts, window_started_at FROM phone_verifications WHERE user_id = $1 FOR UPDATE
+		`
+		attempts, windowStartedAt := 0, time.Now()
+		err := tx.QueryRowContext(ctx, query, userID).Scan(&attempts, &windowStartedAt)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if time.Since(windowStartedAt) >= phoneCodeAttemptWindow {
+			attempts, windowStartedAt = 0, time.Now()
+		}
+		if attempts >= maxPhoneCodeAttempts {
+			windowEnd := windowStartedAt.Add(phoneCodeAttemptWindow)
+			retryAt = &windowEnd
+			return Error_TooManyCodeRequests
+		}
+
+		query = `
+			SELECT MAX(created_at) FROM phone_verifications WHERE user_id = $1 OR phone = $2
+		`
+		var lastSent *time.Time
+		if err := tx.QueryRowContext(ctx, query, userID, phone).Scan(&lastSent); err != nil {
+			return err
+		}
+		if lastSent != nil && time.Since(*lastSent) < cooldown {
+			cooldownEnd := lastSent.Add(cooldown)
+			retryAt = &cooldownEnd
+			return Error_TooManyCodeRequests
+		}
+
+		query = `
+			INSERT INTO phone_verifications (user_id, phone, code_hash, attempts, expires_at, window_started_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id) DO UPDATE SET
+				phone = EXCLUDED.phone,
+				code_hash = EXCLUDED.code_hash,
+				attempts = EXCLUDED.attempts,
+				expires_at = EXCLUDED.expires_at,
+				window_started_at = EXCLUDED.window_started_at,
+				created_at = NOW()
+		`
+		_, err = tx.ExecContext(ctx, query, userID, phone, hashToken(code), attempts, time.Now().Add(expiration), windowStartedAt)
+		return err
+	})
+	return retryAt, err
+}
+
+// Verify moves the phone onto the user when the code matches. Every try counts against the attempts,
+// so the count is kept even when the code is wrong.
+func (s *PhoneVerificationStorage) Verify(ctx context.Context, userID int64, code string) (string, error) {
+	query := `
+		UPDATE phone_verifications SET attempts = attempts + 1
+		WHERE user_id = $1
+		RETURNING phone, code_hash, attempts, expires_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var (
+		phone     string
+		codeHash  string
+		attempts  int
+		expiresAt time.Time
+	)
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&phone,
+		&codeHash,
+		&attempts,
+		&expiresAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return "", Error_NotFound
+		default:
+			return "", translateError(err)
+		}
+	}
+	if attempts > maxPhoneCodeAttempts || time.Now().Compare(expiresAt) >= 0 {
+		return "", Error_Expired
+	}
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashToken(code))) != 1 {
+		return "", Error_InvalidCode
+	}
+
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM phone_verifications WHERE user_id = $1 AND code_hash = $2
+		`
+		res, err := tx.ExecContext(ctx, query, userID, codeHash)
+		if err != nil {
+			return err
+		}
+		//a new code was requested in the meantime
+		if n, _ := res.RowsAffected(); n == 0 {
+			return Error_Expired
+		}
+
+		query = `
+			UPDATE users SET phone = $1, phone_verified_at = NOW()
+			WHERE id = $2
+		`
+		_, err = tx.ExecContext(ctx, query, phone, userID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return phone, nil
+}
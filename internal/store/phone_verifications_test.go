@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// sendPhoneCode requests a code as if the last one had been sent an hour ago
+func sendPhoneCode(t *testing.T, storage Storage, db *sql.DB, userID int64, phone, code string) error {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, `UPDATE phone_verifications SET created_at = created_at - INTERVAL '1 hour'`); err != nil {
+		t.Fatal(err)
+	}
+	_, err := storage.PhoneVerifications.CreateRequest(ctx, userID, phone, code, time.Minute*10, time.Minute)
+	return err
+}
+
+func TestPhoneCodeCooldown(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	userID := createTestUser(t, db, "customer@example.com", RoleCustomer, true)
+	otherID := createTestUser(t, db, "other@example.com", RoleCustomer, true)
+
+	if err := sendPhoneCode(t, storage, db, userID, "+38761000000", "111111"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		phone  string
+	}{
+		{"the same user and phone", userID, "+38761000000"},
+		{"the same user with another phone", userID, "+38761999999"},
+		{"another user with the same phone", otherID, "+38761000000"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retryAt, err := storage.PhoneVerifications.CreateRequest(ctx, test.userID, test.phone, "222222", time.Minute*10, time.Minute)
+			if err != Error_TooManyCodeRequests {
+				t.Fatalf("got %v, want %v", err, Error_TooManyCodeRequests)
+			}
+			if retryAt == nil || time.Until(*retryAt) <= 0 || time.Until(*retryAt) > time.Minute+time.Second {
+				t.Fatalf("retry at %v, want within the cooldown", retryAt)
+			}
+		})
+	}
+
+	if _, err := storage.PhoneVerifications.Verify(ctx, userID, "111111"); err != nil {
+		t.Fatalf("the first code stopped working: %s", err)
+	}
+}
+
+func TestPhoneCodeAttemptsSurviveResends(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	userID := createTestUser(t, db, "customer@example.com", RoleCustomer, true)
+
+	guessWrong := func(times int) {
+		t.Helper()
+		for range times {
+			if _, err := storage.PhoneVerifications.Verify(ctx, userID, "000000"); err != Error_InvalidCode {
+				t.Fatalf("got %v, want %v", err, Error_InvalidCode)
+			}
+		}
+	}
+
+	if err := sendPhoneCode(t, storage, db, userID, "+38761000000", "111111"); err != nil {
+		t.Fatal(err)
+	}
+	guessWrong(3)
+
+	if err := sendPhoneCode(t, storage, db, userID, "+38761000000", "222222"); err != nil {
+		t.Fatal(err)
+	}
+	guessWrong(maxPhoneCodeAttempts - 3)
+
+	//the new code doesn't give the guesses back
+	if _, err := storage.PhoneVerifications.Verify(ctx, userID, "222222"); err != Error_Expired {
+		t.Fatalf("got %v, want %v", err, Error_Expired)
+	}
+	if err := sendPhoneCode(t, storage, db, userID, "+38761000000", "333333"); err != Error_TooManyCodeRequests {
+		t.Fatalf("got %v, want %v", err, Error_TooManyCodeRequests)
+	}
+
+	//a day later the attempts start over
+	if _, err := db.ExecContext(ctx, `UPDATE phone_verifications SET window_started_at = window_started_at - INTERVAL '1 day'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendPhoneCode(t, storage, db, userID, "+38761000000", "444444"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.PhoneVerifications.Verify(ctx, userID, "444444"); err != nil {
+		t.Fatal(err)
+	}
+}
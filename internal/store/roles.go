@@ -0,0 +1,15 @@
+package store
+
+const (
+	RoleCustomer = "customer"
+	RoleWorker   = "worker"
+	RoleManager  = "manager"
+	RoleOwner    = "owner"
+)
+
+var Roles = []string{RoleCustomer, RoleWorker, RoleManager, RoleOwner}
+
+// IsStaff reports whether the role belongs to someone working in the shop
+func IsStaff(role string) bool {
+	return role == RoleWorker || role == RoleManager || role == RoleOwner
+}
@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"time"
 )
@@ -16,20 +18,38 @@ var (
 type Storage struct {
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
-		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		CreateAndInvite(context.Context, *User, string, time.Duration) (bool, error)
 		DeleteUserWithInvitation(context.Context, int64, string) error
+		ReleaseWalkIn(context.Context, int64, string) error
 		Activate(context.Context, string) error
 		GetByID(context.Context, int64) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
+		GetByIdentity(context.Context, string, string) (*User, error)
+		LinkOrCreateByIdentity(context.Context, *User, Identity) error
+		UpdateRole(context.Context, int64, string) error
+		Lock(context.Context, int64, time.Time) (bool, error)
+		Unlock(context.Context, int64) error
+		ReissueInvitation(context.Context, string, string, time.Duration, time.Duration) (*User, error)
+		DeleteUnactivated(context.Context, time.Time) (int64, error)
+		UpdateProfile(context.Context, *User) error
+		UpdateNotificationChannel(context.Context, int64, string) error
+		RemovePhone(context.Context, int64) error
 	}
 	TimeSlots interface {
 		GetSlots(context.Context, time.Time, int64, bool) ([]TimeSlot, error)
-		GetMyAppointments(context.Context, int64) ([]TimeSlot, error)
+		GetMyAppointments(context.Context, int64) ([]Appointment, error)
 		GetBookedNumberForAMonth(context.Context, int, int64) ([]NumberOfSlots, error)
-		Book(context.Context, int64, int64, int64) (*time.Time, error)
+		Book(context.Context, int64, int64, int64) (*BookedSlot, error)
 		CreateNewSlot(context.Context, int64, time.Time, time.Duration) (*time.Time, error)
-		RemoveSlot(context.Context, int64) error
-		UpdateStatus(context.Context, int64, string, *int64, string) error
+		BookFor(context.Context, int64, int64, int64, *int64, string) (*BookedSlot, error)
+		BookForGuest(context.Context, int64, *User, int64, *int64, string) (*BookedSlot, error)
+		SetManageToken(context.Context, int64, string) error
+		GetByManageToken(context.Context, string, string) (*ManagedBooking, error)
+		CancelByManageToken(context.Context, string, string, string) (*ManagedBooking, error)
+		RescheduleByManageToken(context.Context, string, int64, string) (*ManagedBooking, error)
+		RemoveSlot(context.Context, int64, *int64) error
+		Transition(context.Context, StatusChange) (*BookedSlot, error)
+		ListEvents(context.Context, int64, *int64) ([]AppointmentEvent, error)
 	}
 	Workers interface {
 		CreateOrUpdateSettings(context.Context, int64, map[string]string, int, int) error
@@ -39,15 +59,94 @@ type Storage struct {
 		CreateResetPasswordRequest(context.Context, int64, string, time.Duration) error
 		DeleteResetPasswordRequest(context.Context, int64) error
 		UpdatePassword(context.Context, password, string) (*int64, error)
+		GetUserByResetToken(context.Context, string) (*User, error)
+		ChangePassword(context.Context, int64, password, time.Time) error
+	}
+	Customers interface {
+		Get(context.Context, int64) (*User, error)
+		GetByEmail(context.Context, string) (*User, error)
+		GetHistory(context.Context, int64) (*CustomerHistory, error)
+		GetNotes(context.Context, int64) (*CustomerNotes, error)
+		UpsertNotes(context.Context, *CustomerNotes) error
+		Search(context.Context, CustomerQuery) (*CustomerList, error)
+		CreateWalkIn(context.Context, *User) error
+	}
+	UserData interface {
+		Export(context.Context, *User) (*UserExport, error)
+		ScheduleDeletion(context.Context, int64) (*time.Time, error)
+		CancelDeletion(context.Context, int64) error
+		AnonymiseDue(context.Context, time.Time) (int64, error)
+	}
+	EmailChanges interface {
+		CreateRequest(context.Context, int64, string, string, time.Duration) error
+		DeleteRequest(context.Context, int64) error
+		Confirm(context.Context, string) error
+	}
+	WorkerInvitations interface {
+		Create(context.Context, *WorkerInvitation, string) error
+		Get(context.Context, string) (*WorkerInvitation, error)
+		Delete(context.Context, string) error
+		Accept(context.Context, string, *User) (*User, error)
+	}
+	FailedLogins interface {
+		Record(context.Context, string, string) error
+		Stats(context.Context, string, string, time.Time) (*FailedLoginStats, error)
+		Clear(context.Context, string) error
+		DeleteBefore(context.Context, time.Time) (int64, error)
+	}
+	GuestBookings interface {
+		Hold(context.Context, *GuestBookingRequest, string, int) (*time.Time, error)
+		Confirm(context.Context, string) (*GuestBooking, error)
+		Delete(context.Context, string) error
+		ReleaseExpiredHolds(context.Context) (int64, error)
+	}
+	Notifications interface {
+		Record(context.Context, *AppointmentNotification) error
+		ClaimDueReminders(context.Context, time.Time) ([]BookedSlot, error)
+	}
+	OIDCStates interface {
+		Create(context.Context, *OIDCLoginState) error
+		Consume(context.Context, string, string) (*OIDCLoginState, error)
+	}
+	EmailTemplates interface {
+		Get(context.Context, string, string) (*EmailTemplate, error)
+		List(context.Context) ([]EmailTemplate, error)
+		Upsert(context.Context, *EmailTemplate) error
+		Delete(context.Context, string, string) error
+	}
+	PhoneVerifications interface {
+		CreateRequest(context.Context, int64, string, string, time.Duration, time.Duration) (*time.Time, error)
+		Verify(context.Context, int64, string) (string, error)
+	}
+	Webhooks interface {
+		CreateSubscription(context.Context, *WebhookSubscription) error
+		GetSubscription(context.Context, int64) (*WebhookSubscription, error)
+		ListSubscriptions(context.Context) ([]WebhookSubscription, error)
+		UpdateSubscription(context.Context, *WebhookSubscription) error
+		DeleteSubscription(context.Context, int64) error
+		ListDeliveries(context.Context, WebhookDeliveryQuery) (*WebhookDeliveryList, error)
+		ClaimDue(context.Context, int, time.Duration) ([]WebhookDelivery, error)
+		RecordAttempt(context.Context, *WebhookDelivery) error
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Users:           &UserStorage{db},
-		TimeSlots:       &TimeSlotsStorage{db},
-		Workers:         &WorkerProfileStorage{db},
-		PasswordManager: &PasswordManagerStorage{db},
+		Users:              &UserStorage{db},
+		TimeSlots:          &TimeSlotsStorage{db},
+		Workers:            &WorkerProfileStorage{db},
+		PasswordManager:    &PasswordManagerStorage{db},
+		Customers:          &CustomerStorage{db},
+		UserData:           &UserDataStorage{db},
+		EmailChanges:       &EmailChangeStorage{db},
+		WorkerInvitations:  &WorkerInvitationStorage{db},
+		FailedLogins:       &FailedLoginStorage{db},
+		GuestBookings:      &GuestBookingStorage{db},
+		Notifications:      &NotificationStorage{db},
+		OIDCStates:         &OIDCStateStorage{db},
+		EmailTemplates:     &EmailTemplateStorage{db},
+		PhoneVerifications: &PhoneVerificationStorage{db},
+		Webhooks:           &WebhookStorage{db},
 	}
 }
 
@@ -55,13 +154,19 @@ func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
 	tx, err := db.BeginTx(ctx, nil)
 
 	if err != nil {
-		return nil
+		return translateError(err)
 	}
 
 	if err := fn(tx); err != nil {
 		_ = tx.Rollback()
-		return err
+		return translateError(err)
 	}
 
-	return tx.Commit()
+	return translateError(tx.Commit())
+}
+
+// tokens sent by email are only stored as their sha256 hash
+func hashToken(plainToken string) string {
+	hash := sha256.Sum256([]byte(plainToken))
+	return hex.EncodeToString(hash[:])
 }
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// newTestStorage migrates a fresh schema in the database at TEST_DB_ADDR and drops it after the test,
+// tests that need Postgres are skipped without it
+func newTestStorage(t *testing.T) (Storage, *sql.DB) {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin, err := sql.Open("postgres", addr)
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+	})
+
+	//every connection of the pool has to look in the new schema, extensions stay in public
+	separator := "?"
+	if strings.Contains(addr, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("postgres", addr+separator+"search_path="+schema+",public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		query, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(query)); err != nil {
+			t.Fatalf("%s: %s", filepath.Base(migration), err)
+		}
+	}
+
+	return NewStorage(db), db
+}
+
+func createTestUser(t *testing.T, db *sql.DB, email, role string, isActive bool) int64 {
+	t.Helper()
+
+	var id int64
+	query := `
+		INSERT INTO users (username, first_name, last_name, email, password, roles, is_active)
+		VALUES ($1, 'Test', 'User', $2, $3, $4, $5)
+		RETURNING id
+	`
+	username := strings.ReplaceAll(email, "@", "_")
+	if err := db.QueryRowContext(context.Background(), query, username, email, []byte("x"), role, isActive).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -3,10 +3,15 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
+var (
+	Error_SlotOverlap = errors.New("the slot overlaps an existing one")
+)
+
 type TimeSlotsStorage struct {
 	db *sql.DB
 }
@@ -32,15 +37,16 @@ func (s *TimeSlotsStorage) GetSlots(ctx context.Context, selectedDay time.Time,
 	query :=
 		`
 		SELECT 
-			t.id, t.is_booked, t.start_time, t.status,
-			c.id, c.first_name, c.last_name, c.email,
+			t.id, t.is_booked, t.start_time, COALESCE(a.status, 'available'),
+			c.id, c.first_name, c.last_name, c.email, c.phone,
 			w.id, w.first_name
 		FROM time_slots t
-		LEFT JOIN users c ON c.id = t.user_id
+		LEFT JOIN appointments a ON a.slot_id = t.id AND a.status NOT IN ` + inactiveStatuses + `
+		LEFT JOIN users c ON c.id = a.customer_id
 		JOIN users w ON w.id = t.worker_id
 		WHERE is_booked = $3 AND
 			start_time >= $1::timestamp AND start_time < $2::timestamp AND
-			worker_id = $4;
+			t.worker_id = $4;
 		`
 	rows, err := s.db.QueryContext(
 		ctx,
@@ -60,8 +66,8 @@ func (s *TimeSlotsStorage) GetSlots(ctx context.Context, selectedDay time.Time,
 		}
 	}
 	var (
-		userID                     sql.NullInt64
-		firstName, lastName, email sql.NullString
+		userID                            sql.NullInt64
+		firstName, lastName, email, phone sql.NullString
 	)
 
 	var timeSlots []TimeSlot
@@ -76,6 +82,7 @@ func (s *TimeSlotsStorage) GetSlots(ctx context.Context, selectedDay time.Time,
 			&firstName,
 			&lastName,
 			&email,
+			&phone,
 			&slot.WorkerID,
 			&slot.WorkerFirstName,
 		)
@@ -90,6 +97,9 @@ func (s *TimeSlotsStorage) GetSlots(ctx context.Context, selectedDay time.Time,
 				LastName:  lastName.String,
 				Email:     email.String,
 			}
+			if phone.Valid {
+				slot.User.Phone = &phone.String
+			}
 		} else {
 			slot.User = nil
 		}
@@ -100,13 +110,15 @@ func (s *TimeSlotsStorage) GetSlots(ctx context.Context, selectedDay time.Time,
 	defer rows.Close()
 	return timeSlots, nil
 }
-func (s *TimeSlotsStorage) GetMyAppointments(ctx context.Context, userID int64) ([]TimeSlot, error) {
+
+// GetMyAppointments returns the customer's latest appointments, cancelled ones included
+func (s *TimeSlotsStorage) GetMyAppointments(ctx context.Context, userID int64) ([]Appointment, error) {
 	query := `
 		SELECT 	
-			t.id, t.is_booked, t.start_time, t.status,		
+			a.id, a.slot_id, a.start_time, a.duration, a.service, a.status,
 			customer.id AS customer_id,
 			customer.username AS customer_username,
-			customer.email AS customer_email,
+			COALESCE(customer.email, '') AS customer_email,
 			customer.first_name AS customer_first_name,
 			customer.last_name AS customer_last_name,
 			customer.created_at AS customer_created_at,
@@ -114,12 +126,12 @@ func (s *TimeSlotsStorage) GetMyAppointments(ctx context.Context, userID int64)
 
 			worker.id AS worker_id,
 			worker.first_name AS worker_first_name
-		FROM time_slots t
-		JOIN users customer ON t.user_id = customer.id
-		JOIN users worker ON t.worker_id = worker.id
-		WHERE t.user_id = $1 AND t.is_booked = true
-		ORDER BY t.start_time ASC
-		LIMIT 10
+		FROM appointments a
+		JOIN users customer ON a.customer_id = customer.id
+		JOIN users worker ON a.worker_id = worker.id
+		WHERE a.customer_id = $1
+		ORDER BY a.start_time DESC
+		LIMIT 20
 	`
 	rows, err := s.db.QueryContext(
 		ctx,
@@ -135,41 +147,41 @@ func (s *TimeSlotsStorage) GetMyAppointments(ctx context.Context, userID int64)
 			return nil, err
 		}
 	}
-	var timeSlots []TimeSlot
+	defer rows.Close()
+
+	var appointments []Appointment
 	for rows.Next() {
-		var slot TimeSlot
-		slot.User = &User{}
+		var appointment Appointment
+		appointment.Customer = &User{}
 		err := rows.Scan(
-			&slot.ID,
-			&slot.IsBooked,
-			&slot.StartTime,
-			&slot.Status,
-			&slot.User.ID,
-			&slot.User.Username,
-			&slot.User.Email,
-			&slot.User.FirstName,
-			&slot.User.LastName,
-			&slot.User.Created_at,
-			&slot.User.Role,
-			&slot.WorkerID,
-			&slot.WorkerFirstName,
+			&appointment.ID,
+			&appointment.SlotID,
+			&appointment.StartTime,
+			&appointment.Duration,
+			&appointment.Service,
+			&appointment.Status,
+			&appointment.Customer.ID,
+			&appointment.Customer.Username,
+			&appointment.Customer.Email,
+			&appointment.Customer.FirstName,
+			&appointment.Customer.LastName,
+			&appointment.Customer.Created_at,
+			&appointment.Customer.Role,
+			&appointment.WorkerID,
+			&appointment.WorkerFirstName,
 		)
 		if err != nil {
-			return timeSlots, err
+			return appointments, err
 		}
-		timeSlots = append(timeSlots, slot)
+		appointments = append(appointments, appointment)
 	}
-
-	defer rows.Close()
-	return timeSlots, nil
-
+	return appointments, rows.Err()
 }
 
 func (s *TimeSlotsStorage) GetBookedNumberForAMonth(ctx context.Context, month int, workerID int64) ([]NumberOfSlots, error) {
 	query := `
-		SELECT DATE(start_time) as day, COUNT(*) AS booked_slots FROM time_slots 
-		WHERE is_booked = TRUE AND
-		EXTRACT(MONTH FROM start_time) = $1 AND
+		SELECT DATE(start_time) as day, COUNT(*) AS booked_slots FROM appointments 
+		WHERE EXTRACT(MONTH FROM start_time) = $1 AND
 		worker_id = $2 AND status = 'booked'
 		GROUP BY DATE(start_time)
 		ORDER BY day;
@@ -207,35 +219,117 @@ func (s *TimeSlotsStorage) GetBookedNumberForAMonth(ctx context.Context, month i
 	return timeSlots, nil
 }
 
-func (s *TimeSlotsStorage) Book(ctx context.Context, slotID, workerID, userID int64) (*time.Time, error) {
-	query := `
-		UPDATE time_slots
-		SET is_booked = true, user_id = $2, status = 'booked'
-		WHERE id = $1 AND worker_id = $3 AND is_booked = false
-		RETURNING start_time
-	`
-	//TODO mzd u ovom query treba izbaciti ovo worker_id mzd je double checking bez razloga al aj
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+func (s *TimeSlotsStorage) Book(ctx context.Context, slotID, workerID, userID int64) (*BookedSlot, error) {
+	var slot *BookedSlot
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		//TODO mzd u ovom query treba izbaciti ovo worker_id mzd je double checking bez razloga al aj
+		slot, err = bookSlot(ctx, tx, newAppointment{
+			SlotID:     slotID,
+			WorkerID:   &workerID,
+			CustomerID: &userID,
+			Status:     StatusBooked,
+		})
+		if err != nil {
+			return err
+		}
 
-	var bookedTime time.Time
-	//TODO  -dodaj da izbaci gresku ako se bukira termin koji je vec zauzet
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		slotID,
-		userID,
-		workerID,
-	).Scan(
-		&bookedTime,
-	)
+		return recordEvent(ctx, tx, &AppointmentEvent{
+			AppointmentID: slot.AppointmentID,
+			SlotID:        &slot.ID,
+			CustomerID:    &userID,
+			FromStatus:    StatusAvailable,
+			ToStatus:      StatusBooked,
+			ActorID:       &userID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// BookFor books a free slot for the customer on behalf of staff, a non nil workerID limits it to that worker's slots
+func (s *TimeSlotsStorage) BookFor(ctx context.Context, slotID, customerID, actorID int64, workerID *int64, service string) (*BookedSlot, error) {
+	var slot *BookedSlot
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		slot, err = bookFor(ctx, tx, slotID, customerID, actorID, workerID, service)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// BookForGuest books the slot like BookFor for a guest without an account. The guest's customer record
+// is found by email or created as a walk-in together with the booking, so a slot that can't be booked
+// leaves no record behind. An email that belongs to staff is a duplicate.
+func (s *TimeSlotsStorage) BookForGuest(ctx context.Context, slotID int64, guest *User, actorID int64, workerID *int64, service string) (*BookedSlot, error) {
+	var slot *BookedSlot
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		found := false
+		if guest.Email != "" {
+			query := `
+				SELECT id, roles = 'customer' AND deleted_at IS NULL FROM users WHERE email = $1 FOR UPDATE
+			`
+			var isCustomer bool
+			err := tx.QueryRowContext(ctx, query, guest.Email).Scan(&guest.ID, &isCustomer)
+			switch err {
+			case nil:
+				if !isCustomer {
+					return Error_DuplicateEmail
+				}
+				found = true
+			case sql.ErrNoRows:
+			default:
+				return err
+			}
+		}
+		if !found {
+			if err := createWalkIn(ctx, tx, guest); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		slot, err = bookFor(ctx, tx, slotID, guest.ID, actorID, workerID, service)
+		return err
+	})
 	if err != nil {
-		return &time.Time{}, err
+		return nil, err
 	}
-	if err == sql.ErrNoRows {
-		return &time.Time{}, Error_NotFound
+	return slot, nil
+}
+
+func bookFor(ctx context.Context, tx *sql.Tx, slotID, customerID, actorID int64, workerID *int64, service string) (*BookedSlot, error) {
+	slot, err := bookSlot(ctx, tx, newAppointment{
+		SlotID:     slotID,
+		WorkerID:   workerID,
+		CustomerID: &customerID,
+		Status:     StatusBooked,
+		Service:    service,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordEvent(ctx, tx, &AppointmentEvent{
+		AppointmentID: slot.AppointmentID,
+		SlotID:        &slot.ID,
+		CustomerID:    &customerID,
+		FromStatus:    StatusAvailable,
+		ToStatus:      StatusBooked,
+		ActorID:       &actorID,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return &bookedTime, nil
+	return slot, nil
 }
 
 func (s *TimeSlotsStorage) CreateNewSlot(ctx context.Context, workerID int64, timeStamp time.Time, duration time.Duration) (*time.Time, error) {
@@ -244,11 +338,11 @@ func (s *TimeSlotsStorage) CreateNewSlot(ctx context.Context, workerID int64, ti
 
 	//checking for overlap and suggesting a valid timestamp
 	query := `
-		SELECT MAX(start_time + duration) AS latest_end_time
+		SELECT MAX(end_time) AS latest_end_time
 		FROM time_slots 
 		WHERE worker_id = $2
 		  AND start_time < $1::timestamp + $3 ::interval
-		  AND start_time + duration > $1::timestamp;
+		  AND end_time > $1::timestamp;
 	`
 	intervalStr := fmt.Sprintf("%.0f minutes", duration.Minutes())
 	var newTimeToTry *time.Time
@@ -269,16 +363,10 @@ func (s *TimeSlotsStorage) CreateNewSlot(ctx context.Context, workerID int64, ti
 		return newTimeToTry, nil
 	}
 
-	//inserting into the database but checking once again if it overlaps just in case (not necessary)
+	//the exclusion constraint catches a slot created by a concurrent request since the check above
 	query = `
 		INSERT INTO time_slots (start_time, worker_id, duration)
-		SELECT $1::timestamp, $2, $3 ::interval
-		WHERE NOT EXISTS (
-			SELECT 1 FROM time_slots 
-			WHERE worker_id = $2
-			AND start_time < $1::timestamp + $3 ::interval
-      		AND start_time + duration > $1::timestamp
-		);
+		VALUES ($1::timestamp, $2, $3 ::interval)
 	`
 	_, err = s.db.ExecContext(
 		ctx,
@@ -289,65 +377,34 @@ func (s *TimeSlotsStorage) CreateNewSlot(ctx context.Context, workerID int64, ti
 	)
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return nil, nil
 }
 
-func (s *TimeSlotsStorage) RemoveSlot(ctx context.Context, slotID int64) error {
-	query := `
-		DELETE FROM time_slots WHERE id = $1 AND is_booked=FALSE;
-	`
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-
-	rows, err := s.db.ExecContext(ctx, query, slotID)
-
-	if err != nil {
-		return nil
-	}
-	rowsAffected, err := rows.RowsAffected()
-	if err != nil {
-		return nil
-	}
-	if rowsAffected == 0 {
-		return Error_NotFound
-	}
-	return nil
-}
-
-func (s *TimeSlotsStorage) UpdateStatus(ctx context.Context, slotID int64, newStatus string, userID *int64, cancellationWindow string) error {
+// workerID restricts the removal to that worker's slots, nil allows any slot
+func (s *TimeSlotsStorage) RemoveSlot(ctx context.Context, slotID int64, workerID *int64) error {
 	query := `
-		UPDATE time_slots
-		SET status = $1
+		DELETE FROM time_slots WHERE id = $1 AND is_booked=FALSE
 	`
-	args := []interface{}{newStatus}
+	args := []interface{}{slotID}
 
-	if newStatus == "available" {
-		query += `, is_booked = FALSE, user_id = NULL`
+	if workerID != nil {
+		query += ` AND worker_id = $2`
+		args = append(args, *workerID)
 	}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
-	query += `
-		WHERE id = $2 AND is_booked = TRUE`
-	args = append(args, slotID)
-
-	if userID != nil {
-		query += ` AND user_id = $3 AND status = 'booked' AND NOW() + $4::INTERVAL < start_time`
-		args = append(args, *userID, cancellationWindow)
-	}
-	rows, err := s.db.ExecContext(
-		ctx,
-		query,
-		args...,
-	)
+	rows, err := s.db.ExecContext(ctx, query, args...)
 
 	if err != nil {
-		return nil
+		return translateError(err)
 	}
 	rowsAffected, err := rows.RowsAffected()
 	if err != nil {
-		return nil
+		return err
 	}
 	if rowsAffected == 0 {
 		return Error_NotFound
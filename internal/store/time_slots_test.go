@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func createTestSlot(t *testing.T, storage Storage, db *sql.DB, workerID int64, start time.Time) int64 {
+	t.Helper()
+	ctx := context.Background()
+
+	suggested, err := storage.TimeSlots.CreateNewSlot(ctx, workerID, start, time.Minute*30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggested != nil {
+		t.Fatalf("the slot at %s overlaps, next free time %s", start, suggested)
+	}
+
+	var slotID int64
+	query := `
+		SELECT id FROM time_slots WHERE worker_id = $1 AND start_time = $2
+	`
+	if err := db.QueryRowContext(ctx, query, workerID, start).Scan(&slotID); err != nil {
+		t.Fatal(err)
+	}
+	return slotID
+}
+
+func countUsersByEmail(t *testing.T, db *sql.DB, email string) int {
+	t.Helper()
+
+	var count int
+	if err := db.QueryRowContext(context.Background(), `SELECT COUNT(*) FROM users WHERE email = $1`, email).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestBookForGuest(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	workerID := createTestUser(t, db, "worker@example.com", RoleWorker, true)
+	start := time.Now().Add(time.Hour * 24).Truncate(time.Hour)
+	slotID := createTestSlot(t, storage, db, workerID, start)
+	otherSlotID := createTestSlot(t, storage, db, workerID, start.Add(time.Hour))
+
+	guest := func() *User {
+		return &User{FirstName: "Guest", LastName: "Customer", Email: "guest@example.com", Locale: "en"}
+	}
+
+	t.Run("a slot that can't be booked leaves no record", func(t *testing.T) {
+		if _, err := storage.TimeSlots.BookForGuest(ctx, slotID+1000, guest(), workerID, nil, ""); err != Error_NotFound {
+			t.Fatalf("got %v, want %v", err, Error_NotFound)
+		}
+		if count := countUsersByEmail(t, db, "guest@example.com"); count != 0 {
+			t.Fatalf("%d records were left behind", count)
+		}
+	})
+
+	var customerID int64
+	t.Run("creates the walk-in with the booking", func(t *testing.T) {
+		slot, err := storage.TimeSlots.BookForGuest(ctx, slotID, guest(), workerID, nil, "haircut")
+		if err != nil {
+			t.Fatal(err)
+		}
+		customer, err := storage.Customers.Get(ctx, *slot.CustomerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !customer.IsWalkIn || customer.Email != "guest@example.com" {
+			t.Fatalf("got %+v, want a walk-in with the guest's email", customer)
+		}
+		customerID = customer.ID
+	})
+
+	t.Run("a taken slot leaves no second record", func(t *testing.T) {
+		other := guest()
+		other.Email = "late@example.com"
+		if _, err := storage.TimeSlots.BookForGuest(ctx, slotID, other, workerID, nil, ""); err != Error_NotFound {
+			t.Fatalf("got %v, want %v", err, Error_NotFound)
+		}
+		if count := countUsersByEmail(t, db, "late@example.com"); count != 0 {
+			t.Fatalf("%d records were left behind", count)
+		}
+	})
+
+	t.Run("reuses the record of a returning guest", func(t *testing.T) {
+		slot, err := storage.TimeSlots.BookForGuest(ctx, otherSlotID, guest(), workerID, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *slot.CustomerID != customerID {
+			t.Fatalf("booked for customer %d, want %d", *slot.CustomerID, customerID)
+		}
+	})
+
+	t.Run("an email of staff is a duplicate", func(t *testing.T) {
+		staff := guest()
+		staff.Email = "worker@example.com"
+		freeSlotID := createTestSlot(t, storage, db, workerID, start.Add(time.Hour*2))
+		if _, err := storage.TimeSlots.BookForGuest(ctx, freeSlotID, staff, workerID, nil, ""); err != Error_DuplicateEmail {
+			t.Fatalf("got %v, want %v", err, Error_DuplicateEmail)
+		}
+	})
+}
+
+func TestCreateNewSlotConcurrently(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	workerID := createTestUser(t, db, "worker@example.com", RoleWorker, true)
+	start := time.Now().Add(time.Hour * 24).Truncate(time.Hour)
+
+	//the requests race for four start times 10 minutes apart, each overlapping its neighbours
+	const requests = 12
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+		errs    = make(chan error, requests)
+	)
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			suggested, err := storage.TimeSlots.CreateNewSlot(ctx, workerID, start.Add(time.Minute*10*time.Duration(i%4)), time.Minute*30)
+			switch {
+			case err == Error_SlotOverlap, err == nil && suggested != nil:
+			case err == nil:
+				created.Add(1)
+			default:
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	var overlapping int
+	query := `
+		SELECT COUNT(*) FROM time_slots t
+		JOIN time_slots o ON o.worker_id = t.worker_id AND o.id > t.id
+		WHERE t.start_time < o.end_time AND t.end_time > o.start_time
+	`
+	if err := db.QueryRowContext(ctx, query).Scan(&overlapping); err != nil {
+		t.Fatal(err)
+	}
+	if overlapping != 0 {
+		t.Fatalf("%d pairs of slots overlap", overlapping)
+	}
+
+	var slots int32
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM time_slots WHERE worker_id = $1`, workerID).Scan(&slots); err != nil {
+		t.Fatal(err)
+	}
+	if slots == 0 || slots != created.Load() {
+		t.Fatalf("%d slots were created, %d requests reported one", slots, created.Load())
+	}
+}
+
+func TestBookConcurrently(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	workerID := createTestUser(t, db, "worker@example.com", RoleWorker, true)
+	slotID := createTestSlot(t, storage, db, workerID, time.Now().Add(time.Hour*24).Truncate(time.Hour))
+
+	const customers = 10
+	customerIDs := make([]int64, customers)
+	for i := range customerIDs {
+		customerIDs[i] = createTestUser(t, db, fmt.Sprintf("customer%d@example.com", i), RoleCustomer, true)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		winners = make(chan int64, customers)
+		errs    = make(chan error, customers)
+	)
+	for i, customerID := range customerIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			//half of the customers book themselves, staff books for the other half
+			var err error
+			if i%2 == 0 {
+				_, err = storage.TimeSlots.Book(ctx, slotID, workerID, customerID)
+			} else {
+				_, err = storage.TimeSlots.BookFor(ctx, slotID, customerID, workerID, &workerID, "")
+			}
+			switch err {
+			case nil:
+				winners <- customerID
+			case Error_NotFound:
+			default:
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(winners)
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if len(winners) != 1 {
+		t.Fatalf("%d customers booked the slot, want exactly one", len(winners))
+	}
+	winner := <-winners
+
+	var appointments int
+	var customerID int64
+	query := `
+		SELECT COUNT(*), MIN(customer_id) FROM appointments WHERE slot_id = $1 AND status = $2
+	`
+	if err := db.QueryRowContext(ctx, query, slotID, StatusBooked).Scan(&appointments, &customerID); err != nil {
+		t.Fatal(err)
+	}
+	if appointments != 1 || customerID != winner {
+		t.Fatalf("got %d appointments for customer %d, want one for %d", appointments, customerID, winner)
+	}
+}
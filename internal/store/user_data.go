@@ -0,0 +1,482 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserExport is everything we hold about a user, returned for data access requests
+type UserExport struct {
+	Profile               *User                  `json:"profile"`
+	Appointments          []ExportedAppointment  `json:"appointments"`
+	PasswordResetRequests []ExportedTokenRequest `json:"password_reset_requests"`
+	Invitations           []ExportedTokenRequest `json:"invitations"`
+	EmailChangeRequests   []ExportedEmailChange  `json:"email_change_requests"`
+	Identities            []ExportedIdentity     `json:"identities"`
+	FailedLogins          []ExportedFailedLogin  `json:"failed_logins"`
+	AppointmentEvents     []ExportedEvent        `json:"appointment_events"`
+	Notifications         []ExportedNotification `json:"appointment_notifications"`
+	GuestBookingRequests  []ExportedGuestBooking `json:"guest_booking_requests"`
+	PhoneVerifications    []ExportedPhoneCode    `json:"phone_verifications"`
+	CustomerNotes         *CustomerNotes         `json:"customer_notes,omitempty"`
+	WorkerProfile         *WorkerProfile         `json:"worker_profile,omitempty"`
+}
+
+type ExportedAppointment struct {
+	ID              int64  `json:"id"`
+	StartTime       string `json:"start_time"`
+	Duration        string `json:"duration"`
+	Status          string `json:"status"`
+	WorkerID        int64  `json:"worker_id"`
+	WorkerFirstName string `json:"worker_first_name"`
+}
+
+type ExportedTokenRequest struct {
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+type ExportedEmailChange struct {
+	NewEmail  string    `json:"new_email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ExportedIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedFailedLogin struct {
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportedEvent is a status change of one of the user's appointments or one the user made
+type ExportedEvent struct {
+	AppointmentID *int64    `json:"appointment_id,omitempty"`
+	FromStatus    string    `json:"from_status"`
+	ToStatus      string    `json:"to_status"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ExportedNotification struct {
+	AppointmentID *int64    `json:"appointment_id,omitempty"`
+	Event         string    `json:"event"`
+	Reason        string    `json:"reason"`
+	Delivery      string    `json:"delivery"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExportedGuestBooking is a guest booking made with the user's email that wasn't confirmed yet
+type ExportedGuestBooking struct {
+	AppointmentID int64     `json:"appointment_id"`
+	FirstName     string    `json:"first_name"`
+	LastName      string    `json:"last_name"`
+	Phone         string    `json:"phone"`
+	Locale        string    `json:"locale"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+type ExportedPhoneCode struct {
+	Phone     string    `json:"phone"`
+	Attempts  int       `json:"attempts"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserDataStorage struct {
+	db *sql.DB
+}
+
+func (s *UserDataStorage) Export(ctx context.Context, user *User) (*UserExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	export := &UserExport{
+		Profile:               user,
+		Appointments:          []ExportedAppointment{},
+		PasswordResetRequests: []ExportedTokenRequest{},
+		Invitations:           []ExportedTokenRequest{},
+		EmailChangeRequests:   []ExportedEmailChange{},
+		Identities:            []ExportedIdentity{},
+		FailedLogins:          []ExportedFailedLogin{},
+		AppointmentEvents:     []ExportedEvent{},
+		Notifications:         []ExportedNotification{},
+		GuestBookingRequests:  []ExportedGuestBooking{},
+		PhoneVerifications:    []ExportedPhoneCode{},
+	}
+
+	query := `
+		SELECT a.id, a.start_time, a.duration, a.status, w.id, w.first_name
+		FROM appointments a
+		JOIN users w ON w.id = a.worker_id
+		WHERE a.customer_id = $1
+		ORDER BY a.start_time
+	`
+	rows, err := s.db.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var appointment ExportedAppointment
+		if err := rows.Scan(
+			&appointment.ID,
+			&appointment.StartTime,
+			&appointment.Duration,
+			&appointment.Status,
+			&appointment.WorkerID,
+			&appointment.WorkerFirstName,
+		); err != nil {
+			return nil, err
+		}
+		export.Appointments = append(export.Appointments, appointment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT created_at, expires_at FROM reset_password_requests WHERE user_id = $1
+	`
+	if export.PasswordResetRequests, err = s.exportTokenRequests(ctx, query, user.ID); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT NULL::timestamp, expires_at FROM user_invitations WHERE user_id = $1
+	`
+	if export.Invitations, err = s.exportTokenRequests(ctx, query, user.ID); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT new_email, created_at, expires_at FROM email_change_requests WHERE user_id = $1
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var request ExportedEmailChange
+		if err := rows.Scan(&request.NewEmail, &request.CreatedAt, &request.ExpiresAt); err != nil {
+			return nil, err
+		}
+		export.EmailChangeRequests = append(export.EmailChangeRequests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT provider, email, created_at FROM user_identities WHERE user_id = $1
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var identity ExportedIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.Identities = append(export.Identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT ip, created_at FROM failed_logins WHERE email = $1
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var failedLogin ExportedFailedLogin
+		if err := rows.Scan(&failedLogin.IP, &failedLogin.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.FailedLogins = append(export.FailedLogins, failedLogin)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT appointment_id, from_status, to_status, reason, created_at FROM appointment_events
+		WHERE customer_id = $1 OR actor_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event ExportedEvent
+		if err := rows.Scan(
+			&event.AppointmentID,
+			&event.FromStatus,
+			&event.ToStatus,
+			&event.Reason,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		export.AppointmentEvents = append(export.AppointmentEvents, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT appointment_id, event, reason, delivery, created_at FROM appointment_notifications
+		WHERE recipient_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var notification ExportedNotification
+		if err := rows.Scan(
+			&notification.AppointmentID,
+			&notification.Event,
+			&notification.Reason,
+			&notification.Delivery,
+			&notification.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		export.Notifications = append(export.Notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT appointment_id, first_name, last_name, phone, locale, expires_at FROM guest_booking_requests
+		WHERE email = $1
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var request ExportedGuestBooking
+		if err := rows.Scan(
+			&request.AppointmentID,
+			&request.FirstName,
+			&request.LastName,
+			&request.Phone,
+			&request.Locale,
+			&request.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		export.GuestBookingRequests = append(export.GuestBookingRequests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT phone, attempts, expires_at, created_at FROM phone_verifications WHERE user_id = $1
+	`
+	rows, err = s.db.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code ExportedPhoneCode
+		if err := rows.Scan(&code.Phone, &code.Attempts, &code.ExpiresAt, &code.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.PhoneVerifications = append(export.PhoneVerifications, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	customerNotes, err := (&CustomerStorage{s.db}).GetNotes(ctx, user.ID)
+	switch err {
+	case nil:
+		export.CustomerNotes = customerNotes
+	case Error_NotFound:
+	default:
+		return nil, err
+	}
+
+	workerProfile, err := (&WorkerProfileStorage{s.db}).GetSettings(ctx, user.ID)
+	switch err {
+	case nil:
+		export.WorkerProfile = workerProfile
+	case Error_NotFound:
+	default:
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *UserDataStorage) exportTokenRequests(ctx context.Context, query string, userID int64) ([]ExportedTokenRequest, error) {
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []ExportedTokenRequest{}
+	for rows.Next() {
+		var request ExportedTokenRequest
+		if err := rows.Scan(&request.CreatedAt, &request.ExpiresAt); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+func (s *UserDataStorage) ScheduleDeletion(ctx context.Context, userID int64) (*time.Time, error) {
+	query := `
+		UPDATE users SET deletion_requested_at = COALESCE(deletion_requested_at, NOW())
+		WHERE id = $1
+		RETURNING deletion_requested_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var requestedAt time.Time
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&requestedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, translateError(err)
+		}
+	}
+	return &requestedAt, nil
+}
+
+func (s *UserDataStorage) CancelDeletion(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users SET deletion_requested_at = NULL
+		WHERE id = $1 AND deletion_requested_at IS NOT NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+// AnonymiseDue anonymises every user whose deletion was requested before the cutoff.
+// The users row stays so the appointments that reference it keep counting in the statistics,
+// everything that identifies the person is overwritten or deleted.
+func (s *UserDataStorage) AnonymiseDue(ctx context.Context, cutoff time.Time) (int64, error) {
+	var anonymised int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, COALESCE(email, '') FROM users
+			WHERE deletion_requested_at < $1 AND deleted_at IS NULL
+			FOR UPDATE
+		`
+		rows, err := tx.QueryContext(ctx, query, cutoff)
+		if err != nil {
+			return err
+		}
+
+		type dueUser struct {
+			id    int64
+			email string
+		}
+		var due []dueUser
+		for rows.Next() {
+			var user dueUser
+			if err := rows.Scan(&user.id, &user.email); err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, user := range due {
+			if err := anonymiseUser(ctx, tx, user.id, user.email); err != nil {
+				return err
+			}
+			anonymised++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return anonymised, nil
+}
+
+func anonymiseUser(ctx context.Context, tx *sql.Tx, userID int64, email string) error {
+	queries := []string{
+		`DELETE FROM reset_password_requests WHERE user_id = $1`,
+		`DELETE FROM user_invitations WHERE user_id = $1`,
+		`DELETE FROM email_change_requests WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM customer_notes WHERE customer_id = $1`,
+		`DELETE FROM phone_verifications WHERE user_id = $1`,
+		`UPDATE appointment_events SET reason = '' WHERE customer_id = $1 OR actor_id = $1`,
+		`UPDATE appointment_notifications SET reason = '' WHERE recipient_id = $1 OR actor_id = $1`,
+		`UPDATE users SET
+			email = 'deleted-' || id || '@deleted.invalid',
+			username = 'deleted-' || id,
+			first_name = 'Deleted',
+			last_name = 'User',
+			phone = NULL,
+			phone_verified_at = NULL,
+			notification_channel = 'email',
+			password = ''::bytea,
+			is_active = FALSE,
+			locked_until = NULL,
+			tokens_valid_after = NOW(),
+			deleted_at = NOW()
+		WHERE id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		DELETE FROM failed_logins WHERE email = $1
+	`
+	if _, err := tx.ExecContext(ctx, query, email); err != nil {
+		return err
+	}
+	return nil
+}
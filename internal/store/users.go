@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -14,18 +13,29 @@ var (
 	Error_DuplicateEmail    = errors.New("a user with that email already exists")
 	Error_DuplicateUsername = errors.New("a user with that username already exists")
 	Error_UserNotVerified   = errors.New("user has not verified their email")
+	Error_InvitationRecent  = errors.New("an activation email was sent recently")
 )
 
 type User struct {
-	ID         int64    `json:"id"`
-	FirstName  string   `json:"first_name"`
-	LastName   string   `json:"last_name"`
-	Username   string   `json:"username"`
-	Email      string   `json:"email"`
-	Password   password `json:"-"`
-	Created_at string   `json:"created_at"`
-	Role       string   `json:"role"`
-	IsActive   bool     `json:"is_active"`
+	ID          int64      `json:"id"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	Phone       *string    `json:"phone,omitempty"`
+	Password    password   `json:"-"`
+	Created_at  string     `json:"created_at"`
+	Role        string     `json:"role"`
+	IsActive    bool       `json:"is_active"`
+	IsWalkIn    bool       `json:"is_walk_in"`
+	Locale      string     `json:"locale"` //language of the emails sent to the user
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	//texts only go to a verified phone
+	PhoneVerifiedAt     *time.Time `json:"phone_verified_at,omitempty"`
+	NotificationChannel string     `json:"notification_channel"`
+	//tokens issued before this are no longer accepted
+	TokensValidAfter    *time.Time `json:"-"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
 }
 type UserStorage struct {
 	db *sql.DB
@@ -57,8 +67,8 @@ func (p *password) ComparePasswords(password string) bool {
 func (u *UserStorage) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 	query :=
 		`
-		INSERT INTO users (username, first_name, last_name,  email, password, roles) 
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at
+		INSERT INTO users (username, first_name, last_name,  email, password, roles, locale) 
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, ''), 'bs')) RETURNING id, created_at, locale
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -71,26 +81,21 @@ func (u *UserStorage) Create(ctx context.Context, tx *sql.Tx, user *User) error
 		user.Email,
 		user.Password.hash,
 		user.Role,
+		user.Locale,
 	).Scan(
 		&user.ID,
 		&user.Created_at,
+		&user.Locale,
 	)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return Error_DuplicateEmail
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
-			return Error_DuplicateUsername
-		default:
-			return err
-		}
+		return translateError(err)
 	}
-	return nil
+	return enqueueUserWebhook(ctx, tx, user)
 }
 
 func (u *UserStorage) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, email, first_name, last_name, username, password, created_at, roles, is_active FROM users 
+		SELECT id, COALESCE(email, ''), phone, first_name, last_name, username, password, created_at, roles, is_active, is_walk_in, locale, locked_until, tokens_valid_after, deletion_requested_at, phone_verified_at, notification_channel FROM users 
 		WHERE email = $1
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -104,6 +109,7 @@ func (u *UserStorage) GetByEmail(ctx context.Context, email string) (*User, erro
 	).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Phone,
 		&user.FirstName,
 		&user.LastName,
 		&user.Username,
@@ -111,6 +117,13 @@ func (u *UserStorage) GetByEmail(ctx context.Context, email string) (*User, erro
 		&user.Created_at,
 		&user.Role,
 		&user.IsActive,
+		&user.IsWalkIn,
+		&user.Locale,
+		&user.LockedUntil,
+		&user.TokensValidAfter,
+		&user.DeletionRequestedAt,
+		&user.PhoneVerifiedAt,
+		&user.NotificationChannel,
 	)
 
 	if err != nil {
@@ -129,7 +142,7 @@ func (u *UserStorage) GetByEmail(ctx context.Context, email string) (*User, erro
 
 func (u *UserStorage) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT id, email, first_name, last_name, username, password, created_at, roles, is_active FROM users 
+		SELECT id, COALESCE(email, ''), phone, first_name, last_name, username, password, created_at, roles, is_active, is_walk_in, locale, locked_until, tokens_valid_after, deletion_requested_at, phone_verified_at, notification_channel FROM users 
 		WHERE id = $1
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -143,6 +156,7 @@ func (u *UserStorage) GetByID(ctx context.Context, userID int64) (*User, error)
 	).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Phone,
 		&user.FirstName,
 		&user.LastName,
 		&user.Username,
@@ -150,6 +164,13 @@ func (u *UserStorage) GetByID(ctx context.Context, userID int64) (*User, error)
 		&user.Created_at,
 		&user.Role,
 		&user.IsActive,
+		&user.IsWalkIn,
+		&user.Locale,
+		&user.LockedUntil,
+		&user.TokensValidAfter,
+		&user.DeletionRequestedAt,
+		&user.PhoneVerifiedAt,
+		&user.NotificationChannel,
 	)
 
 	if err != nil {
@@ -166,33 +187,56 @@ func (u *UserStorage) GetByID(ctx context.Context, userID int64) (*User, error)
 	return &user, nil
 }
 
-func (u *UserStorage) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
-	return withTx(u.db, ctx, func(tx *sql.Tx) error {
-		//create user
-		if err := u.Create(ctx, tx, user); err != nil {
+// CreateAndInvite reports whether the user claimed a walk-in record, so a failed registration
+// can give the record back instead of deleting the customer's history
+func (u *UserStorage) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) (bool, error) {
+	var claimed bool
+	err := withTx(u.db, ctx, func(tx *sql.Tx) error {
+		//create user, or claim the walk-in record a worker made for this email
+		var err error
+		claimed, err = claimWalkIn(ctx, tx, user)
+		if err != nil {
 			return err
 		}
-		log.Printf("created")
-		//create invitation
-		if err := u.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
-			return err
+		if !claimed {
+			if err := u.Create(ctx, tx, user); err != nil {
+				return err
+			}
+			return u.createUserInvitation(ctx, tx, token, invitationExp, user.ID, nil)
 		}
-		log.Printf("created inv")
-
-		return nil
+		return u.createUserInvitation(ctx, tx, token, invitationExp, user.ID, user)
 	})
+	return claimed, err
 }
 
-func (u *UserStorage) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, invitationExp time.Duration, userID int64) error {
+// createUserInvitation keeps the details of a registration that claimed a walk-in on the invitation, claim is nil otherwise
+func (u *UserStorage) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, invitationExp time.Duration, userID int64, claim *User) error {
 	query := `
-		INSERT INTO user_invitations (token, user_id, expires_at) VALUES ($1, $2, $3)
+		INSERT INTO user_invitations (
+			token, user_id, expires_at,
+			claim_username, claim_first_name, claim_last_name, claim_password, claim_role, claim_locale
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
+	var (
+		username, firstName, lastName, role, locale *string
+		passwordHash                                []byte
+	)
+	if claim != nil {
+		username, firstName, lastName, role, locale = &claim.Username, &claim.FirstName, &claim.LastName, &claim.Role, &claim.Locale
+		passwordHash = claim.Password.hash
+	}
 	_, err := tx.ExecContext(
 		ctx,
 		query,
-		token,
+		hashToken(token),
 		userID,
 		time.Now().Add(invitationExp),
+		username,
+		firstName,
+		lastName,
+		passwordHash,
+		role,
+		locale,
 	)
 
 	if err != nil {
@@ -201,13 +245,22 @@ func (u *UserStorage) createUserInvitation(ctx context.Context, tx *sql.Tx, toke
 	return nil
 }
 
+// Activate confirms the email of the invited user. A walk-in record only takes over the details
+// of the registration that claimed it here, the other claims of it are dropped.
 func (u *UserStorage) Activate(ctx context.Context, token string) error {
 	return withTx(u.db, ctx, func(tx *sql.Tx) error {
-		user, err := getUserByInvitation(ctx, tx, token)
+		user, claim, err := getUserByInvitation(ctx, tx, token)
 		if err != nil {
 			return err
 		}
 
+		if claim != nil {
+			if err := applyWalkInClaim(ctx, tx, user, claim); err != nil {
+				return err
+			}
+			return deleteUserInvitations(ctx, tx, user.ID)
+		}
+
 		user.IsActive = true
 		if err := updateUserStatus(ctx, tx, user); err != nil {
 			return err
@@ -219,21 +272,30 @@ func (u *UserStorage) Activate(ctx context.Context, token string) error {
 		return nil
 	})
 }
-func getUserByInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+
+// getUserByInvitation returns the details of the registration that claimed the walk-in as well, nil when it wasn't a claim
+func getUserByInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, *User, error) {
 	query := `
-		SELECT u.id, u.email, u.username, u.created_at, u.is_active 
+		SELECT u.id, COALESCE(u.email, ''), u.username, u.created_at, u.is_active,
+			i.claim_username, COALESCE(i.claim_first_name, ''), COALESCE(i.claim_last_name, ''),
+			i.claim_password, COALESCE(i.claim_role, ''), COALESCE(i.claim_locale, '')
 		FROM users u
 		JOIN user_invitations i ON i.user_id = u.id
 		WHERE i.token = $1 AND i.expires_at > $2
+		FOR UPDATE OF u
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	var user User
+	var (
+		user          User
+		claim         User
+		claimUsername *string
+	)
 	err := tx.QueryRowContext(
 		ctx,
 		query,
-		token,
+		hashToken(token),
 		time.Now(),
 	).Scan(
 		&user.ID,
@@ -241,18 +303,65 @@ func getUserByInvitation(ctx context.Context, tx *sql.Tx, token string) (*User,
 		&user.Username,
 		&user.Created_at,
 		&user.IsActive,
+		&claimUsername,
+		&claim.FirstName,
+		&claim.LastName,
+		&claim.Password.hash,
+		&claim.Role,
+		&claim.Locale,
 	)
 
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
-			return nil, Error_NotFound
+			return nil, nil, Error_NotFound
 		default:
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	return &user, nil
+	if claimUsername == nil {
+		return &user, nil, nil
+	}
+	claim.Username = *claimUsername
+	return &user, &claim, nil
+}
+
+// applyWalkInClaim turns the walk-in into a regular active account with the claim's details
+func applyWalkInClaim(ctx context.Context, tx *sql.Tx, user *User, claim *User) error {
+	query := `
+		UPDATE users SET
+			username = $1, first_name = $2, last_name = $3, password = $4,
+			roles = $5, is_walk_in = FALSE, is_active = TRUE, locale = COALESCE(NULLIF($6, ''), locale)
+		WHERE id = $7 AND is_walk_in = TRUE
+		RETURNING locale
+	`
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		claim.Username,
+		claim.FirstName,
+		claim.LastName,
+		claim.Password.hash,
+		claim.Role,
+		claim.Locale,
+		user.ID,
+	).Scan(
+		&user.Locale,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			//the record became an account some other way in the meantime
+			return Error_NotFound
+		default:
+			return translateError(err)
+		}
+	}
+	user.Username, user.FirstName, user.LastName, user.Role = claim.Username, claim.FirstName, claim.LastName, claim.Role
+	user.IsActive = true
+	return enqueueUserWebhook(ctx, tx, user)
 }
+
 func updateUserStatus(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
 		UPDATE users SET is_active = $1
@@ -280,7 +389,7 @@ func deleteUserInvitation(ctx context.Context, tx *sql.Tx, token string) error {
 	_, err := tx.ExecContext(
 		ctx,
 		query,
-		token,
+		hashToken(token),
 	)
 
 	if err != nil {
@@ -303,6 +412,19 @@ func (u *UserStorage) DeleteUserWithInvitation(ctx context.Context, userID int64
 	})
 }
 
+// ReleaseWalkIn undoes a registration that claimed a walk-in record. The record itself is only changed
+// on activation, so dropping the claim's invitation leaves it as it was.
+func (u *UserStorage) ReleaseWalkIn(ctx context.Context, userID int64, token string) error {
+	query := `
+		DELETE FROM user_invitations WHERE token = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := u.db.ExecContext(ctx, query, hashToken(token), userID)
+	return err
+}
+
 func deleteUser(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `
 		DELETE FROM users
@@ -318,3 +440,286 @@ func deleteUser(ctx context.Context, tx *sql.Tx, userID int64) error {
 	}
 	return nil
 }
+
+func (u *UserStorage) UpdateRole(ctx context.Context, userID int64, role string) error {
+	query := `
+		UPDATE users SET roles = $1
+		WHERE id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.ExecContext(ctx, query, role, userID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+// Lock locks the account until the given time unless it is already locked,
+// it reports whether the lock was set so the owner is only told once
+func (u *UserStorage) Lock(ctx context.Context, userID int64, until time.Time) (bool, error) {
+	query := `
+		UPDATE users SET locked_until = $1
+		WHERE id = $2 AND (locked_until IS NULL OR locked_until <= NOW())
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.ExecContext(ctx, query, until, userID)
+	if err != nil {
+		return false, translateError(err)
+	}
+	n, err := rows.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Unlock lifts the lock and forgets the failed logins that caused it
+func (u *UserStorage) Unlock(ctx context.Context, userID int64) error {
+	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET locked_until = NULL
+			WHERE id = $1
+			RETURNING COALESCE(email, '')
+		`
+		var email string
+		if err := tx.QueryRowContext(ctx, query, userID).Scan(&email); err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			DELETE FROM failed_logins WHERE email = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, email); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// ReissueInvitation replaces the invitations of a user that never activated their account with a new one.
+// A walk-in is only invited again for the latest registration that claimed it. Within cooldown of
+// the latest invitation it fails with Error_InvitationRecent, so the address can't be flooded with emails.
+func (u *UserStorage) ReissueInvitation(ctx context.Context, email, token string, invitationExp, cooldown time.Duration) (*User, error) {
+	var user User
+
+	err := withTx(u.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, email, username, locale FROM users u
+			WHERE email = $1 AND is_active = FALSE AND (is_walk_in = FALSE OR EXISTS (
+				SELECT 1 FROM user_invitations i WHERE i.user_id = u.id AND i.claim_username IS NOT NULL
+			))
+			FOR UPDATE
+		`
+		err := tx.QueryRowContext(ctx, query, email).Scan(
+			&user.ID,
+			&user.Email,
+			&user.Username,
+			&user.Locale,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			SELECT MAX(created_at) FROM user_invitations WHERE user_id = $1
+		`
+		var lastSent *time.Time
+		if err := tx.QueryRowContext(ctx, query, user.ID).Scan(&lastSent); err != nil {
+			return err
+		}
+		if lastSent != nil && time.Since(*lastSent) < cooldown {
+			return Error_InvitationRecent
+		}
+
+		claim, err := latestWalkInClaim(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if claim != nil {
+			user.Username, user.Locale = claim.Username, claim.Locale
+		}
+
+		if err := deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		return u.createUserInvitation(ctx, tx, token, invitationExp, user.ID, claim)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUnactivated removes users that registered before the cutoff, never activated their account
+// and have no invitation that is still valid after it, their invitations are removed by the cascade.
+// Anonymised accounts and walk-in customers are inactive too but are kept for the slot history,
+// a claimed walk-in stays a walk-in until activation so its record and notes are kept as well.
+func (u *UserStorage) DeleteUnactivated(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM users u
+		WHERE u.is_active = FALSE AND u.is_walk_in = FALSE AND u.deleted_at IS NULL AND u.created_at < $1 AND NOT EXISTS (
+			SELECT 1 FROM user_invitations i
+			WHERE i.user_id = u.id AND i.expires_at > $1
+		) AND NOT EXISTS (
+			SELECT 1 FROM appointments a WHERE a.customer_id = u.id
+		)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return rows.RowsAffected()
+}
+
+func (u *UserStorage) UpdateProfile(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users SET first_name = $1, last_name = $2, username = $3, locale = $4
+		WHERE id = $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.ExecContext(
+		ctx,
+		query,
+		user.FirstName,
+		user.LastName,
+		user.Username,
+		user.Locale,
+		user.ID,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+// UpdateNotificationChannel fails with Error_PhoneNotVerified when the channel needs a phone the user hasn't verified
+func (u *UserStorage) UpdateNotificationChannel(ctx context.Context, userID int64, channel string) error {
+	query := `
+		UPDATE users SET notification_channel = $1
+		WHERE id = $2 AND ($1 = 'email' OR phone_verified_at IS NOT NULL)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.ExecContext(ctx, query, channel, userID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_PhoneNotVerified
+	}
+	return nil
+}
+
+// RemovePhone forgets the phone and moves the user back to email notifications
+func (u *UserStorage) RemovePhone(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users SET phone = NULL, phone_verified_at = NULL, notification_channel = 'email'
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+// claimWalkIn finds the walk-in customer with the user's email. The record is left as it is until
+// the email is confirmed, the registration's details go on its invitation instead.
+func claimWalkIn(ctx context.Context, tx *sql.Tx, user *User) (bool, error) {
+	query := `
+		SELECT id, created_at FROM users
+		WHERE email = $1 AND is_walk_in = TRUE
+		FOR UPDATE
+	`
+	err := tx.QueryRowContext(ctx, query, user.Email).Scan(&user.ID, &user.Created_at)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	//the username is only taken on activation, a duplicate is still refused right away
+	query = `
+		SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)
+	`
+	var taken bool
+	if err := tx.QueryRowContext(ctx, query, user.Username).Scan(&taken); err != nil {
+		return false, err
+	}
+	if taken {
+		return false, Error_DuplicateUsername
+	}
+	return true, nil
+}
+
+// latestWalkInClaim is the registration that claimed the walk-in last, nil when there's none
+func latestWalkInClaim(ctx context.Context, tx *sql.Tx, userID int64) (*User, error) {
+	query := `
+		SELECT claim_username, claim_first_name, claim_last_name, claim_password, claim_role, claim_locale
+		FROM user_invitations
+		WHERE user_id = $1 AND claim_username IS NOT NULL
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`
+	var claim User
+	err := tx.QueryRowContext(ctx, query, userID).Scan(
+		&claim.Username,
+		&claim.FirstName,
+		&claim.LastName,
+		&claim.Password.hash,
+		&claim.Role,
+		&claim.Locale,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return &claim, nil
+}
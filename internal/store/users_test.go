@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func newTestWalkIn(t *testing.T, storage Storage, email string) *User {
+	t.Helper()
+
+	walkIn := &User{FirstName: "Walk", LastName: "In", Email: email}
+	if err := storage.Customers.CreateWalkIn(context.Background(), walkIn); err != nil {
+		t.Fatal(err)
+	}
+	return walkIn
+}
+
+func newTestClaim(t *testing.T, username, email string) *User {
+	t.Helper()
+
+	user := &User{Username: username, FirstName: "Someone", LastName: "Else", Email: email, Role: RoleCustomer}
+	if err := user.Password.Set(username + "-password"); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// assertUntouchedWalkIn fails when the walk-in record lost any of its own details
+func assertUntouchedWalkIn(t *testing.T, storage Storage, db *sql.DB, walkIn *User) {
+	t.Helper()
+	ctx := context.Background()
+
+	customer, err := storage.Customers.Get(ctx, walkIn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !customer.IsWalkIn || customer.IsActive || customer.Username != walkIn.Username {
+		t.Fatalf("got walk-in %t active %t username %q, want the walk-in record %q", customer.IsWalkIn, customer.IsActive, customer.Username, walkIn.Username)
+	}
+	if customer.FirstName != walkIn.FirstName || customer.LastName != walkIn.LastName {
+		t.Fatalf("got %s %s, want the walk-in's own name %s %s", customer.FirstName, customer.LastName, walkIn.FirstName, walkIn.LastName)
+	}
+
+	var hash []byte
+	if err := db.QueryRowContext(ctx, `SELECT password FROM users WHERE id = $1`, walkIn.ID).Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+	if len(hash) != 0 {
+		t.Fatal("the walk-in got a password before the email was confirmed")
+	}
+}
+
+func TestReleaseClaimedWalkIn(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	walkIn := newTestWalkIn(t, storage, "walkin@example.com")
+
+	user := newTestClaim(t, "registered", "walkin@example.com")
+	claimed, err := storage.Users.CreateAndInvite(ctx, user, "walkin-token", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed || user.ID != walkIn.ID {
+		t.Fatalf("claimed %t user %d, want the walk-in %d claimed", claimed, user.ID, walkIn.ID)
+	}
+	assertUntouchedWalkIn(t, storage, db, walkIn)
+
+	//the activation email couldn't be sent
+	if err := storage.Users.ReleaseWalkIn(ctx, user.ID, "walkin-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertUntouchedWalkIn(t, storage, db, walkIn)
+	if err := storage.Users.Activate(ctx, "walkin-token"); err == nil {
+		t.Fatal("the invitation of the failed registration was kept")
+	}
+}
+
+func TestActivateClaimedWalkIn(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	walkIn := newTestWalkIn(t, storage, "walkin@example.com")
+
+	//someone who doesn't own the email claims the walk-in first
+	if _, err := storage.Users.CreateAndInvite(ctx, newTestClaim(t, "claimant", "walkin@example.com"), "claimant-token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Users.CreateAndInvite(ctx, newTestClaim(t, "owner", "walkin@example.com"), "owner-token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	assertUntouchedWalkIn(t, storage, db, walkIn)
+
+	t.Run("unconfirmed claims are kept from the purge", func(t *testing.T) {
+		if _, err := storage.Users.DeleteUnactivated(ctx, time.Now().Add(time.Hour*2)); err != nil {
+			t.Fatal(err)
+		}
+		assertUntouchedWalkIn(t, storage, db, walkIn)
+	})
+
+	t.Run("the confirmed claim takes over the record", func(t *testing.T) {
+		if err := storage.Users.Activate(ctx, "owner-token"); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := storage.Users.GetByEmail(ctx, "walkin@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != walkIn.ID || user.IsWalkIn || !user.IsActive || user.Username != "owner" {
+			t.Fatalf("got user %d walk-in %t active %t username %q, want %d as the owner's active account", user.ID, user.IsWalkIn, user.IsActive, user.Username, walkIn.ID)
+		}
+		if !user.Password.ComparePasswords("owner-password") || user.Password.ComparePasswords("claimant-password") {
+			t.Fatal("the account doesn't log in with the password of the confirmed claim only")
+		}
+	})
+
+	t.Run("the other claims are dropped", func(t *testing.T) {
+		if err := storage.Users.Activate(ctx, "claimant-token"); err != Error_NotFound {
+			t.Fatalf("got %v, want %v", err, Error_NotFound)
+		}
+	})
+}
+
+func TestReissueInvitationOfClaimedWalkIn(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	walkIn := newTestWalkIn(t, storage, "walkin@example.com")
+	if _, err := storage.Users.CreateAndInvite(ctx, newTestClaim(t, "registered", "walkin@example.com"), "first-token", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.Users.ReissueInvitation(ctx, "walkin@example.com", "second-token", time.Hour, time.Minute); err != Error_InvitationRecent {
+		t.Fatalf("resending right away: got %v, want %v", err, Error_InvitationRecent)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE user_invitations SET created_at = created_at - INTERVAL '1 hour'`); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := storage.Users.ReissueInvitation(ctx, "walkin@example.com", "second-token", time.Hour, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != walkIn.ID || user.Username != "registered" {
+		t.Fatalf("got user %d username %q, want the claim of %d", user.ID, user.Username, walkIn.ID)
+	}
+	assertUntouchedWalkIn(t, storage, db, walkIn)
+
+	if err := storage.Users.Activate(ctx, "second-token"); err != nil {
+		t.Fatal(err)
+	}
+	activated, err := storage.Users.GetByEmail(ctx, "walkin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activated.Username != "registered" || !activated.Password.ComparePasswords("registered-password") {
+		t.Fatalf("the reissued invitation lost the claim, username %q", activated.Username)
+	}
+}
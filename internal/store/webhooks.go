@@ -0,0 +1,440 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// events a webhook can subscribe to
+const (
+	WebhookAppointmentBooked        = "appointment.booked"
+	WebhookAppointmentCancelled     = "appointment.cancelled"
+	WebhookAppointmentStatusChanged = "appointment.status_changed"
+	WebhookUserRegistered           = "user.registered"
+)
+
+var WebhookEvents = []string{
+	WebhookAppointmentBooked,
+	WebhookAppointmentCancelled,
+	WebhookAppointmentStatusChanged,
+	WebhookUserRegistered,
+}
+
+// a delivery waits in pending until it's sent or the attempts run out
+const DeliveryPending = "pending"
+
+type WebhookSubscription struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` //only shown when the subscription is created
+	Events    []string  `json:"events"`
+	IsActive  bool      `json:"is_active"`
+	CreatedBy *int64    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	//where the delivery goes, set when it's claimed
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookDeliveryQuery struct {
+	SubscriptionID int64
+	Status         string
+	Limit          int
+	Offset         int
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int               `json:"total"`
+}
+
+// WebhookEnvelope is the body posted to the subscribers
+type WebhookEnvelope struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// AppointmentWebhook is the data of the appointment events
+type AppointmentWebhook struct {
+	AppointmentID  int64     `json:"appointment_id"`
+	SlotID         *int64    `json:"slot_id"`
+	WorkerID       int64     `json:"worker_id"`
+	CustomerID     *int64    `json:"customer_id"`
+	StartTime      time.Time `json:"start_time"`
+	Service        string    `json:"service"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status"`
+	Reason         string    `json:"reason"`
+}
+
+// UserWebhook is the data of user.registered, contact details stay out of it
+type UserWebhook struct {
+	UserID    int64  `json:"user_id"`
+	Role      string `json:"role"`
+	Locale    string `json:"locale"`
+	CreatedAt string `json:"created_at"`
+}
+
+type WebhookStorage struct {
+	db *sql.DB
+}
+
+func (s *WebhookStorage) CreateSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (url, secret, events, is_active, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		subscription.URL,
+		subscription.Secret,
+		pq.Array(subscription.Events),
+		subscription.IsActive,
+		subscription.CreatedBy,
+	).Scan(
+		&subscription.ID,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	return translateError(err)
+}
+
+func (s *WebhookStorage) GetSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	query := `
+		SELECT id, url, events, is_active, created_by, created_at, updated_at
+		FROM webhook_subscriptions
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	subscription := &WebhookSubscription{}
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&subscription.ID,
+		&subscription.URL,
+		pq.Array(&subscription.Events),
+		&subscription.IsActive,
+		&subscription.CreatedBy,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return subscription, nil
+}
+
+func (s *WebhookStorage) ListSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	query := `
+		SELECT id, url, events, is_active, created_by, created_at, updated_at
+		FROM webhook_subscriptions
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var subscription WebhookSubscription
+		err := rows.Scan(
+			&subscription.ID,
+			&subscription.URL,
+			pq.Array(&subscription.Events),
+			&subscription.IsActive,
+			&subscription.CreatedBy,
+			&subscription.CreatedAt,
+			&subscription.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// UpdateSubscription saves the url, events and whether the subscription is active,
+// deliveries of a paused subscription wait until it's active again
+func (s *WebhookStorage) UpdateSubscription(ctx context.Context, subscription *WebhookSubscription) error {
+	query := `
+		UPDATE webhook_subscriptions SET url = $2, events = $3, is_active = $4, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		subscription.ID,
+		subscription.URL,
+		pq.Array(subscription.Events),
+		subscription.IsActive,
+	).Scan(
+		&subscription.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return Error_NotFound
+		default:
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// DeleteSubscription removes the subscription along with its delivery log
+func (s *WebhookStorage) DeleteSubscription(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM webhook_subscriptions WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return translateError(err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+// ListDeliveries returns the delivery log of a subscription, newest first
+func (s *WebhookStorage) ListDeliveries(ctx context.Context, q WebhookDeliveryQuery) (*WebhookDeliveryList, error) {
+	query := `
+		SELECT id, subscription_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, created_at, COUNT(*) OVER()
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.SubscriptionID, q.Status, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &WebhookDeliveryList{Deliveries: []WebhookDelivery{}}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+			&list.Total,
+		); err != nil {
+			return nil, err
+		}
+		list.Deliveries = append(list.Deliveries, delivery)
+	}
+	return list, rows.Err()
+}
+
+// ClaimDue returns up to limit pending deliveries of active subscriptions that are due and pushes their
+// next attempt back by lease, so another instance doesn't send them too while they're in flight
+func (s *WebhookStorage) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d SET next_attempt_at = $2
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT wd.id FROM webhook_deliveries wd
+			JOIN webhook_subscriptions ws ON ws.id = wd.subscription_id
+			WHERE wd.status = 'pending' AND wd.next_attempt_at <= NOW() AND ws.is_active
+			ORDER BY wd.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF wd SKIP LOCKED
+		)
+		RETURNING d.id, d.subscription_id, d.event, d.payload, d.status, d.attempts, d.created_at, s.url, s.secret
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	var due []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.CreatedAt,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, delivery)
+	}
+	return due, rows.Err()
+}
+
+// RecordAttempt saves the outcome of sending a claimed delivery, the caller sets its status and when to try again
+func (s *WebhookStorage) RecordAttempt(ctx context.Context, delivery *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries SET
+			status = $2,
+			attempts = $3,
+			next_attempt_at = $4,
+			last_status_code = $5,
+			last_error = $6,
+			delivered_at = CASE WHEN $2 = 'sent' THEN NOW() END
+		WHERE id = $1
+		RETURNING delivered_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+	).Scan(
+		&delivery.DeliveredAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return Error_NotFound
+		default:
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// enqueueWebhook queues a delivery of the event to every active subscription of it,
+// inside the transaction that caused the event so nothing is sent for a rolled back change
+func enqueueWebhook(ctx context.Context, tx *sql.Tx, event string, data any) error {
+	payload, err := json.Marshal(WebhookEnvelope{
+		Event:      event,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event, payload)
+		SELECT id, $1, $2 FROM webhook_subscriptions
+		WHERE is_active AND $1 = ANY(events)
+	`
+	_, err = tx.ExecContext(ctx, query, event, payload)
+	return err
+}
+
+// enqueueAppointmentWebhook turns a recorded appointment event into a webhook. Guest holds aren't bookings yet,
+// so nothing is sent when one is placed or runs out.
+func enqueueAppointmentWebhook(ctx context.Context, tx *sql.Tx, event *AppointmentEvent) error {
+	var webhookEvent string
+	switch {
+	case event.ToStatus == StatusBooked:
+		webhookEvent = WebhookAppointmentBooked
+	case event.ToStatus == StatusPending || event.FromStatus == StatusPending:
+		return nil
+	case event.ToStatus == StatusCancelledByCustomer || event.ToStatus == StatusCancelledByShop:
+		webhookEvent = WebhookAppointmentCancelled
+	default:
+		webhookEvent = WebhookAppointmentStatusChanged
+	}
+
+	data := AppointmentWebhook{
+		AppointmentID:  event.AppointmentID,
+		SlotID:         event.SlotID,
+		CustomerID:     event.CustomerID,
+		Status:         event.ToStatus,
+		PreviousStatus: event.FromStatus,
+		Reason:         event.Reason,
+	}
+	query := `
+		SELECT worker_id, start_time, service FROM appointments WHERE id = $1
+	`
+	err := tx.QueryRowContext(ctx, query, event.AppointmentID).Scan(
+		&data.WorkerID,
+		&data.StartTime,
+		&data.Service,
+	)
+	if err != nil {
+		return err
+	}
+	return enqueueWebhook(ctx, tx, webhookEvent, data)
+}
+
+func enqueueUserWebhook(ctx context.Context, tx *sql.Tx, user *User) error {
+	return enqueueWebhook(ctx, tx, WebhookUserRegistered, UserWebhook{
+		UserID:    user.ID,
+		Role:      user.Role,
+		Locale:    user.Locale,
+		CreatedAt: user.Created_at,
+	})
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	Error_AccountRequired = errors.New("no account exists for this email, account details are required")
+)
+
+type WorkerInvitation struct {
+	Email     string
+	Shop      string
+	InvitedBy int64
+	ExpiresAt time.Time
+}
+
+type WorkerInvitationStorage struct {
+	db *sql.DB
+}
+
+func (s *WorkerInvitationStorage) Create(ctx context.Context, invitation *WorkerInvitation, plainToken string) error {
+	query := `
+		INSERT INTO worker_invitations (token, email, shop, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(
+		ctx,
+		query,
+		hashToken(plainToken),
+		invitation.Email,
+		invitation.Shop,
+		invitation.InvitedBy,
+		invitation.ExpiresAt,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// Get returns the invitation for the token, expired ones included so Accept can tell them apart
+func (s *WorkerInvitationStorage) Get(ctx context.Context, plainToken string) (*WorkerInvitation, error) {
+	query := `
+		SELECT email, shop, invited_by, expires_at FROM worker_invitations WHERE token = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var invitation WorkerInvitation
+	err := s.db.QueryRowContext(ctx, query, hashToken(plainToken)).Scan(
+		&invitation.Email,
+		&invitation.Shop,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, Error_NotFound
+		default:
+			return nil, err
+		}
+	}
+	return &invitation, nil
+}
+
+func (s *WorkerInvitationStorage) Delete(ctx context.Context, plainToken string) error {
+	query := `
+		DELETE FROM worker_invitations WHERE token = $1;
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.ExecContext(ctx, query, hashToken(plainToken))
+	if err != nil {
+		return err
+	}
+
+	n, _ := rows.RowsAffected()
+	if n == 0 {
+		return Error_NotFound
+	}
+	return nil
+}
+
+// Accept upgrades the account with the invited email to a worker, or creates it from newUser
+// when there is none yet. Since the invitation proves the email address the account is activated.
+// An account that was never activated or a walk-in gets the details of newUser instead of its own,
+// so they are required for it too. Managers and owners keep their role.
+func (s *WorkerInvitationStorage) Accept(ctx context.Context, plainToken string, newUser *User) (*User, error) {
+	var user User
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM worker_invitations
+			WHERE token = $1
+			RETURNING email, expires_at
+		`
+		var (
+			email     string
+			expiresAt time.Time
+		)
+		err := tx.QueryRowContext(ctx, query, hashToken(plainToken)).Scan(&email, &expiresAt)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return Error_NotFound
+			default:
+				return err
+			}
+		}
+		if time.Now().Compare(expiresAt) >= 0 {
+			return Error_Expired
+		}
+
+		query = `
+			SELECT id, roles, is_active, is_walk_in FROM users WHERE email = $1 FOR UPDATE
+		`
+		var wasActive, wasWalkIn bool
+		err = tx.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Role, &wasActive, &wasWalkIn)
+		switch err {
+		case nil:
+			//whoever registered the email never proved they own it and a walk-in has no login,
+			//the account is taken over with the details of the invitee
+			if !wasActive || wasWalkIn {
+				if newUser == nil {
+					return Error_AccountRequired
+				}
+				query = `
+					UPDATE users SET username = $1, first_name = $2, last_name = $3, password = $4, is_walk_in = FALSE
+					WHERE id = $5
+				`
+				_, err := tx.ExecContext(ctx, query, newUser.Username, newUser.FirstName, newUser.LastName, newUser.Password.hash, user.ID)
+				if err != nil {
+					return err
+				}
+			}
+		case sql.ErrNoRows:
+			if newUser == nil {
+				return Error_AccountRequired
+			}
+			newUser.Email = email
+			newUser.Role = RoleWorker
+			if err := (&UserStorage{s.db}).Create(ctx, tx, newUser); err != nil {
+				return err
+			}
+			user.ID = newUser.ID
+			user.Role = newUser.Role
+		default:
+			return err
+		}
+
+		if user.Role == RoleCustomer {
+			user.Role = RoleWorker
+		}
+
+		query = `
+			UPDATE users SET roles = $1, is_active = TRUE
+			WHERE id = $2
+		`
+		if _, err := tx.ExecContext(ctx, query, user.Role, user.ID); err != nil {
+			return err
+		}
+
+		return deleteUserInvitations(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func createTestWorkerInvitation(t *testing.T, storage Storage, invitedBy int64, email, plainToken string) {
+	t.Helper()
+
+	invitation := &WorkerInvitation{Email: email, InvitedBy: invitedBy, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := storage.WorkerInvitations.Create(context.Background(), invitation, plainToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestInvitee(t *testing.T, username string) *User {
+	t.Helper()
+
+	invitee := &User{Username: username, FirstName: "Invited", LastName: "Worker"}
+	if err := invitee.Password.Set("invitee-password"); err != nil {
+		t.Fatal(err)
+	}
+	return invitee
+}
+
+func TestAcceptWorkerInvitation(t *testing.T) {
+	storage, db := newTestStorage(t)
+	ctx := context.Background()
+
+	ownerID := createTestUser(t, db, "owner@example.com", RoleOwner, true)
+
+	t.Run("a squatted email is taken over with the invitee's details", func(t *testing.T) {
+		//someone registered the invitee's email first and never activated it
+		squatter := &User{Username: "squatter", FirstName: "Not", LastName: "Invitee", Email: "invitee@example.com", Role: RoleCustomer}
+		if err := squatter.Password.Set("squatter-password"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.Users.CreateAndInvite(ctx, squatter, "squatter-token", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		createTestWorkerInvitation(t, storage, ownerID, "invitee@example.com", "worker-token")
+
+		if _, err := storage.WorkerInvitations.Accept(ctx, "worker-token", nil); err != Error_AccountRequired {
+			t.Fatalf("got %v, want %v", err, Error_AccountRequired)
+		}
+
+		//the invitation is still there for a second try with the details
+		worker, err := storage.WorkerInvitations.Accept(ctx, "worker-token", newTestInvitee(t, "invitee"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if worker.ID != squatter.ID || worker.Role != RoleWorker {
+			t.Fatalf("got user %d as %s, want %d as a worker", worker.ID, worker.Role, squatter.ID)
+		}
+
+		user, err := storage.Users.GetByEmail(ctx, "invitee@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.IsActive || user.Username != "invitee" {
+			t.Fatalf("got active %t username %q, want the invitee's active account", user.IsActive, user.Username)
+		}
+		if user.Password.ComparePasswords("squatter-password") {
+			t.Fatal("the squatter's password logs into the worker account")
+		}
+		if !user.Password.ComparePasswords("invitee-password") {
+			t.Fatal("the invitee's password doesn't log in")
+		}
+		if err := storage.Users.Activate(ctx, "squatter-token"); err == nil {
+			t.Fatal("the squatter's invitation was kept")
+		}
+	})
+
+	t.Run("a walk-in becomes a regular worker account", func(t *testing.T) {
+		walkIn := &User{FirstName: "Walk", LastName: "In", Email: "walkin@example.com"}
+		if err := storage.Customers.CreateWalkIn(ctx, walkIn); err != nil {
+			t.Fatal(err)
+		}
+		createTestWorkerInvitation(t, storage, ownerID, "walkin@example.com", "walkin-token")
+
+		if _, err := storage.WorkerInvitations.Accept(ctx, "walkin-token", nil); err != Error_AccountRequired {
+			t.Fatalf("got %v, want %v", err, Error_AccountRequired)
+		}
+		if _, err := storage.WorkerInvitations.Accept(ctx, "walkin-token", newTestInvitee(t, "walkin_worker")); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := storage.Users.GetByEmail(ctx, "walkin@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != walkIn.ID || user.IsWalkIn || !user.IsActive || user.Role != RoleWorker {
+			t.Fatalf("got user %d walk-in %t active %t role %s, want %d as an active worker", user.ID, user.IsWalkIn, user.IsActive, user.Role, walkIn.ID)
+		}
+		if !user.Password.ComparePasswords("invitee-password") {
+			t.Fatal("the invitee's password doesn't log in")
+		}
+	})
+
+	t.Run("an active account keeps its password", func(t *testing.T) {
+		customerID := createTestUser(t, db, "customer@example.com", RoleCustomer, true)
+		createTestWorkerInvitation(t, storage, ownerID, "customer@example.com", "customer-token")
+
+		worker, err := storage.WorkerInvitations.Accept(ctx, "customer-token", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if worker.ID != customerID || worker.Role != RoleWorker {
+			t.Fatalf("got user %d as %s, want %d as a worker", worker.ID, worker.Role, customerID)
+		}
+	})
+}
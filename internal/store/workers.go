@@ -43,7 +43,7 @@ func (p *WorkerProfileStorage) CreateOrUpdateSettings(ctx context.Context, worke
 		fmt.Sprintf("%dm", pauseBetween),
 	)
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 	return nil
 }
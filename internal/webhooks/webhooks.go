@@ -0,0 +1,184 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// headers sent with every delivery, the signature covers the timestamp and the body
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// a delivery is given up on after MaxAttempts, the waits between them double from baseDelay up to maxDelay
+const (
+	MaxAttempts = 10
+	baseDelay   = time.Second * 30
+	maxDelay    = time.Hour * 6
+)
+
+var (
+	Error_InvalidSignature = errors.New("the webhook signature doesn't match")
+	Error_StaleTimestamp   = errors.New("the webhook timestamp is too old")
+	Error_PrivateAddress   = errors.New("webhooks can only be sent to public addresses")
+)
+
+// carrier-grade NAT isn't reported as private by net.IP but isn't reachable from the internet either
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublic reports whether the address is reachable from the internet, so a subscriber can't point
+// deliveries at the server itself or the network it runs in
+func isPublic(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !sharedAddressSpace.Contains(ip)
+}
+
+// CheckURL rejects a subscription url that isn't http(s) or whose host resolves to an address that isn't public.
+// The sender checks the address it connects to again, the host may resolve differently by then.
+func CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("the webhook url must be http or https")
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublic(ip) {
+			return Error_PrivateAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("the webhook host can't be resolved: %w", err)
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr.IP) {
+			return Error_PrivateAddress
+		}
+	}
+	return nil
+}
+
+// dialPublic is the dialer Control refusing connections to addresses that aren't public,
+// it sees the resolved address so a host can't pass CheckURL and resolve to a private one later
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return Error_PrivateAddress
+	}
+	return nil
+}
+
+// Sign returns the signature header value of a body sent at the unix timestamp,
+// an HMAC-SHA256 of "timestamp.body" with the subscription's secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received delivery the way a subscriber should,
+// rejecting deliveries older than tolerance so a captured one can't be replayed
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return Error_InvalidSignature
+	}
+	if time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return Error_StaleTimestamp
+	}
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return Error_InvalidSignature
+	}
+	return nil
+}
+
+// Backoff is how long to wait before the next try after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	delay := baseDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+type Sender struct {
+	httpClient *http.Client
+}
+
+// NewSender sends with a client that only connects to public addresses when httpClient is nil.
+// Redirects are never followed, a subscriber answering with one is a failed delivery.
+func NewSender(httpClient *http.Client) *Sender {
+	if httpClient == nil {
+		dialer := &net.Dialer{Timeout: time.Second * 5, Control: dialPublic}
+		httpClient = &http.Client{
+			Timeout: time.Second * 10,
+			//no proxy, the dialer has to see the subscriber's own address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: time.Second * 5,
+				MaxIdleConnsPerHost: 2,
+			},
+		}
+	}
+
+	client := *httpClient
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Sender{httpClient: &client}
+}
+
+// Send posts the payload to the url, any 2xx response counts as delivered.
+// The status code is returned whenever the subscriber answered, also along with an error.
+func (s *Sender) Send(ctx context.Context, url, secret string, deliveryID int64, event string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(deliveryID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, payload))
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return res.StatusCode, fmt.Errorf("subscriber returned status %d: %s", res.StatusCode, body)
+	}
+	//drained so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	return res.StatusCode, nil
+}
@@ -0,0 +1,211 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test"
+
+func TestSend(t *testing.T) {
+	payload := []byte(`{"event":"appointment.booked"}`)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		//the subscriber's side of the delivery
+		if err := Verify(testSecret, r.Header, body, time.Minute*5); err != nil {
+			t.Errorf("the delivery doesn't verify: %s", err)
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get(HeaderEvent) != "appointment.booked" || r.Header.Get(HeaderDelivery) != "42" {
+			t.Errorf("event %q delivery %q", r.Header.Get(HeaderEvent), r.Header.Get(HeaderDelivery))
+		}
+		if string(body) != string(payload) {
+			t.Errorf("body = %s", body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	statusCode, err := NewSender(server.Client()).Send(context.Background(), server.URL, testSecret, 42, "appointment.booked", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNoContent || received.Load() != 1 {
+		t.Fatalf("status %d after %d requests, want %d after one", statusCode, received.Load(), http.StatusNoContent)
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	var redirected atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "subscriber is down", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target", http.StatusFound)
+	})
+	mux.HandleFunc("/target", func(w http.ResponseWriter, r *http.Request) {
+		redirected.Add(1)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sender := NewSender(server.Client())
+	ctx := context.Background()
+
+	t.Run("an error status", func(t *testing.T) {
+		statusCode, err := sender.Send(ctx, server.URL+"/error", testSecret, 1, "user.registered", []byte(`{}`))
+		if err == nil || !strings.Contains(err.Error(), "subscriber is down") {
+			t.Fatalf("got %v, want the subscriber's answer in the error", err)
+		}
+		if statusCode != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d", statusCode, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("a redirect isn't followed", func(t *testing.T) {
+		statusCode, err := sender.Send(ctx, server.URL+"/redirect", testSecret, 1, "user.registered", []byte(`{}`))
+		if err == nil || statusCode != http.StatusFound {
+			t.Fatalf("got status %d error %v, want a failed %d", statusCode, err, http.StatusFound)
+		}
+		if redirected.Load() != 0 {
+			t.Fatal("the redirect was followed")
+		}
+	})
+
+	t.Run("no answer", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		statusCode, err := sender.Send(ctx, closed.URL, testSecret, 1, "user.registered", []byte(`{}`))
+		if err == nil || statusCode != 0 {
+			t.Fatalf("got status %d error %v, want an error without a status", statusCode, err)
+		}
+	})
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	//the default client, the test server listens on loopback
+	_, err := NewSender(nil).Send(context.Background(), server.URL, testSecret, 1, "user.registered", []byte(`{}`))
+	if !errors.Is(err, Error_PrivateAddress) {
+		t.Fatalf("got %v, want %v", err, Error_PrivateAddress)
+	}
+	if received.Load() != 0 {
+		t.Fatal("the delivery reached a loopback address")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+
+	for _, rawURL := range []string{
+		"https://8.8.8.8/hooks",
+		"http://[2001:4860:4860::8888]:8080/hooks",
+	} {
+		if err := CheckURL(ctx, rawURL); err != nil {
+			t.Errorf("%s: %s", rawURL, err)
+		}
+	}
+
+	for _, rawURL := range []string{
+		"http://127.0.0.1/hooks",
+		"http://127.0.0.1:8080/v1/admin/users",
+		"http://0.0.0.0/",
+		"http://10.1.2.3/",
+		"http://172.16.0.1/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://100.64.0.1/",
+		"http://[::1]/",
+		"http://[fd00::1]/",
+		"http://[fe80::1]/",
+		"http://[::ffff:127.0.0.1]/",
+	} {
+		if err := CheckURL(ctx, rawURL); !errors.Is(err, Error_PrivateAddress) {
+			t.Errorf("%s: got %v, want %v", rawURL, err, Error_PrivateAddress)
+		}
+	}
+
+	if err := CheckURL(ctx, "ftp://8.8.8.8/hooks"); err == nil {
+		t.Error("an ftp url was accepted")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"user.registered"}`)
+	signed := func(secret string, sentAt time.Time, body []byte) http.Header {
+		header := http.Header{}
+		header.Set(HeaderTimestamp, strconv.FormatInt(sentAt.Unix(), 10))
+		header.Set(HeaderSignature, Sign(secret, sentAt.Unix(), body))
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   error
+	}{
+		{"valid", signed(testSecret, time.Now(), body), body, nil},
+		{"another secret", signed("whsec_other", time.Now(), body), body, Error_InvalidSignature},
+		{"changed body", signed(testSecret, time.Now(), body), []byte(`{"event":"appointment.booked"}`), Error_InvalidSignature},
+		{"replayed", signed(testSecret, time.Now().Add(-time.Hour), body), body, Error_StaleTimestamp},
+		{"from the future", signed(testSecret, time.Now().Add(time.Hour), body), body, Error_StaleTimestamp},
+		{"no timestamp", http.Header{HeaderSignature: {Sign(testSecret, time.Now().Unix(), body)}}, body, Error_InvalidSignature},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Verify(testSecret, test.header, test.body, time.Minute*5); err != test.want {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, baseDelay},
+		{1, baseDelay},
+		{2, baseDelay * 2},
+		{3, baseDelay * 4},
+		{5, baseDelay * 16},
+		{10, baseDelay * 512},
+		{11, maxDelay},
+		{1000, maxDelay},
+	}
+	for _, test := range tests {
+		if got := Backoff(test.attempts); got != test.want {
+			t.Errorf("Backoff(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+
+	for attempts := 1; attempts < 100; attempts++ {
+		if Backoff(attempts+1) < Backoff(attempts) {
+			t.Fatalf("the wait after %d attempts is shorter than after %d", attempts+1, attempts)
+		}
+	}
+}